@@ -1,4 +1,5 @@
 import { fetchSse, tryExtractDeltaText } from "../sse";
+import { apiFetch, authHeaders } from "./fetch";
 
 function normalizeBaseUrl(url: string): string {
   return url.replace(/\/+$/, "");
@@ -38,23 +39,40 @@ export async function streamChat({
   if (typeof hidden === "boolean") body.hidden = hidden;
   if (Array.isArray(toolKeys)) body.tool_keys = toolKeys;
 
-  await fetchSse(
-    url,
-    {
-      method: "POST",
-      headers: {
-        "content-type": "application/json"
+  // The generation keeps running on the server after the connection drops,
+  // so aborting also stops it explicitly.
+  let streamId: string | null = null;
+  const cancel = () => {
+    if (!streamId) return;
+    void apiFetch(`${url}/${encodeURIComponent(streamId)}`, { method: "DELETE" }).catch(() => undefined);
+  };
+  signal.addEventListener("abort", cancel, { once: true });
+
+  try {
+    await fetchSse(
+      url,
+      {
+        method: "POST",
+        headers: {
+          ...authHeaders(),
+          "content-type": "application/json"
+        },
+        body: JSON.stringify(body),
+        signal
       },
-      body: JSON.stringify(body),
-      signal
-    },
-    {
-      signal,
-      debug,
-      onEvent: (_raw, data) => {
-        const delta = tryExtractDeltaText(data);
-        if (delta) onDeltaText(delta);
+      {
+        signal,
+        debug,
+        onOpen: (res) => {
+          streamId = res.headers.get("x-stream-id");
+        },
+        onEvent: (_raw, data) => {
+          const delta = tryExtractDeltaText(data);
+          if (delta) onDeltaText(delta);
+        }
       }
-    }
-  );
+    );
+  } finally {
+    signal.removeEventListener("abort", cancel);
+  }
 }
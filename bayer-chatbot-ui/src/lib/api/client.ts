@@ -1,3 +1,4 @@
+import { apiFetch } from "./fetch";
 import { ApiRequestError, type ModelsResponse, type OpenAIModel } from "./types";
 
 /**
@@ -72,7 +73,7 @@ function normalizeModelsResponse(json: ModelsResponse): string[] {
  */
 export async function listModels(apiBase: string): Promise<string[]> {
   const url = `${normalizeBaseUrl(apiBase)}/v1/models`;
-  const res = await fetch(url, {
+  const res = await apiFetch(url, {
     headers: {
       accept: "application/json"
     }
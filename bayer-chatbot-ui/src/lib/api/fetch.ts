@@ -0,0 +1,22 @@
+/**
+ * Headers that authenticate the UI to the service.
+ * VITE_API_KEY is sent as a bearer token; without it requests are anonymous,
+ * which only works while the service runs with AUTH_DISABLED=true.
+ */
+export function authHeaders(): Record<string, string> {
+  const key = import.meta.env.VITE_API_KEY;
+  return key ? { authorization: `Bearer ${key}` } : {};
+}
+
+/**
+ * fetch with the service's auth headers added
+ */
+export function apiFetch(url: string, init: RequestInit = {}): Promise<Response> {
+  return fetch(url, {
+    ...init,
+    headers: {
+      ...authHeaders(),
+      ...init.headers
+    }
+  });
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"bayer-chatbot-service/internal/auth"
+	"bayer-chatbot-service/internal/config"
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/httpserver"
+	"bayer-chatbot-service/internal/jobs"
+	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/tracing"
+	"bayer-chatbot-service/internal/upstream"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	if err := config.LoadDotEnv(".env"); err != nil && !os.IsNotExist(err) {
+		logger.New("info").Warn("service.dotenv_error", map[string]interface{}{"error": err.Error()})
+	}
+
+	cfg, err := config.FromEnv()
+	if err != nil {
+		logger.New("info").Error("service.config_error", map[string]interface{}{"error": err.Error()})
+		return 1
+	}
+
+	sinks, err := logger.OpenSinks(cfg.LogOutput, logger.FileOptions{
+		MaxSize:    int64(cfg.LogFileMaxSizeMB) << 20,
+		MaxAge:     cfg.LogFileMaxAge,
+		MaxBackups: cfg.LogFileMaxBackups,
+		Retention:  cfg.LogFileRetention,
+	}, cfg.ServiceName)
+	if err != nil {
+		logger.New("info").Error("service.config_error", map[string]interface{}{"error": err.Error()})
+		return 1
+	}
+	redactor, err := logger.NewRedactor(logger.RedactSpec{
+		Keys:     cfg.LogRedactKeys,
+		Paths:    cfg.LogRedactPaths,
+		Patterns: cfg.LogRedactPatterns,
+		Regex:    cfg.LogRedactRegex,
+		Mode:     cfg.LogRedactMode,
+	})
+	if err != nil {
+		logger.New("info").Error("service.config_error", map[string]interface{}{"error": err.Error()})
+		return 1
+	}
+	logr := logger.NewWithOptions(logger.Options{
+		Level:    cfg.LogLevel,
+		Format:   cfg.LogFormat,
+		Sinks:    sinks,
+		Redactor: redactor,
+	})
+	defer logr.Close()
+
+	var reg *metrics.Registry
+	if cfg.MetricsEnabled {
+		reg = metrics.NewRegistry()
+	}
+
+	var exporter tracing.Exporter = tracing.NewLogExporter(logr.Named("tracing"))
+	if cfg.OTLPEndpoint != "" {
+		exporter = tracing.NewOTLPExporter(cfg.OTLPEndpoint, tracing.ParseHeaders(cfg.OTLPHeaders), cfg.ServiceName, logr.Named("tracing"))
+	}
+	tracer := tracing.NewTracer(exporter)
+	defer func() {
+		// Send spans still queued for the collector.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = tracer.Shutdown(ctx)
+	}()
+
+	client := upstream.NewClient(upstream.Options{
+		BaseURL:       cfg.BayerChatBaseURL,
+		AccessToken:   cfg.BayerChatAccessToken,
+		Project:       cfg.BayerChatProject,
+		TokenMode:     cfg.BayerChatTokenMode,
+		DebugUpstream: cfg.DebugUpstream,
+		Logger:        logr.Named("upstream"),
+		Timeout:       cfg.UpstreamTimeout,
+		Metrics:       reg,
+		Tracer:        tracer,
+		Retry: upstream.RetryPolicy{
+			MaxAttempts: cfg.UpstreamRetryMaxAttempts,
+			BaseDelay:   cfg.UpstreamRetryBaseDelay,
+			MaxDelay:    cfg.UpstreamRetryMaxDelay,
+			Jitter:      cfg.UpstreamRetryJitter,
+		},
+		Breaker: upstream.BreakerPolicy{
+			Window:      cfg.UpstreamBreakerWindow,
+			MinRequests: cfg.UpstreamBreakerMinRequests,
+			FailureRate: cfg.UpstreamBreakerFailureRate,
+			Cooldown:    cfg.UpstreamBreakerCooldown,
+		},
+	})
+
+	store, err := conversations.NewFileStore(cfg.ConversationsDir)
+	if err != nil {
+		logr.Error("service.conversations_error", map[string]interface{}{"error": err.Error(), "dir": cfg.ConversationsDir})
+		return 1
+	}
+
+	var jobStore jobs.Store = jobs.NewMemoryStore()
+	if cfg.JobsDir != "" {
+		fs, err := jobs.NewFileStore(cfg.JobsDir)
+		if err != nil {
+			logr.Error("service.jobs_error", map[string]interface{}{"error": err.Error(), "dir": cfg.JobsDir})
+			return 1
+		}
+		jobStore = fs
+	}
+	jobManager := jobs.NewManager(jobs.Options{
+		Store:     jobStore,
+		Workers:   cfg.JobsWorkers,
+		QueueSize: cfg.JobsQueueSize,
+		MaxEvents: cfg.StreamReplayEvents,
+		Retention: cfg.StreamRetention,
+		Expire:    cfg.JobsRetention,
+		Logger:    logr.Named("jobs"),
+		Metrics:   reg,
+	})
+
+	keys, err := auth.LoadKeys(cfg.APIKeys, cfg.APIKeysFile)
+	if err != nil {
+		logr.Error("service.auth_config_error", map[string]interface{}{"error": err.Error()})
+		return 1
+	}
+	callerTokens, err := auth.ParseCallerTokens(cfg.CallerTokens)
+	if err != nil {
+		logr.Error("service.auth_config_error", map[string]interface{}{"error": err.Error()})
+		return 1
+	}
+	switch {
+	case cfg.AuthDisabled:
+		logr.Warn("service.auth_disabled", map[string]interface{}{"hint": "unset AUTH_DISABLED and set API_KEYS or API_KEYS_FILE to require API keys"})
+	case keys.Len() == 0:
+		logr.Error("service.auth_config_error", map[string]interface{}{"error": "API_KEYS and API_KEYS_FILE contain no keys; set AUTH_DISABLED=true to run without authentication"})
+		return 1
+	}
+
+	// baseCtx is the parent of every request context. Cancelling it after the
+	// shutdown deadline aborts streams that are still relaying upstream bytes.
+	baseCtx, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
+	api := httpserver.New(httpserver.Options{
+		Config:        cfg,
+		Logger:        logr,
+		Client:        client,
+		Conversations: store,
+		Jobs:          jobManager,
+		Keys:          keys,
+		CallerTokens:  callerTokens,
+		Metrics:       reg,
+		Tracer:        tracer,
+	})
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           api,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		BaseContext:       func(net.Listener) context.Context { return baseCtx },
+	}
+	srv.RegisterOnShutdown(api.DrainWebSockets)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		logr.Info("service.listening", map[string]interface{}{
+			"addr":    srv.Addr,
+			"baseUrl": cfg.BayerChatBaseURL,
+		})
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case err := <-serveErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logr.Error("service.listen_error", map[string]interface{}{"error": err.Error()})
+			return 1
+		}
+		return 0
+	case sig := <-sigs:
+		logr.Info("service.shutdown", map[string]interface{}{
+			"signal":    sig.String(),
+			"timeoutMs": cfg.ShutdownTimeout.Milliseconds(),
+		})
+	}
+
+	// Stop accepting new connections and wait for in-flight requests
+	// (including open /v1/chat/stream responses) until the deadline.
+	// WebSocket connections are hijacked, so Shutdown only drains them
+	// through DrainWebSockets and they are waited for below.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// A second signal skips the drain.
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logr.Warn("service.shutdown_deadline", map[string]interface{}{"error": err.Error()})
+		cancelBase()
+		_ = srv.Close()
+		_ = jobManager.Shutdown(ctx)
+		return 1
+	}
+
+	// WebSocket generations still running at the deadline are canceled;
+	// they get a moment to send their done before connections close with
+	// 1001.
+	if err := api.WaitWebSockets(ctx); err != nil {
+		logr.Warn("service.websocket_shutdown_deadline", map[string]interface{}{"error": err.Error()})
+		cancelBase()
+		grace, cancelGrace := context.WithTimeout(context.Background(), time.Second)
+		_ = api.WaitWebSockets(grace)
+		cancelGrace()
+	}
+
+	// Background jobs get what is left of the deadline; unfinished ones
+	// are saved as canceled.
+	if err := jobManager.Shutdown(ctx); err != nil {
+		logr.Warn("service.jobs_shutdown_deadline", map[string]interface{}{"error": err.Error()})
+	}
+
+	logr.Info("service.stopped", nil)
+	return 0
+}
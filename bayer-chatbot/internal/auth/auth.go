@@ -0,0 +1,133 @@
+// Package auth verifies inbound API keys and carries the caller identity in
+// the request context.
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Identity is the authenticated caller.
+type Identity struct {
+	Name string
+}
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the caller attached by the auth middleware.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+type keyEntry struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// KeyStore holds SHA-256 hashes of the accepted API keys; plaintext keys are
+// never kept.
+type KeyStore struct {
+	keys []keyEntry
+}
+
+// ParseKeys reads "name:sha256hex" entries separated by commas or newlines.
+// Blank entries and lines starting with # are ignored.
+func ParseKeys(spec string) (*KeyStore, error) {
+	ks := &KeyStore{}
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" || strings.HasPrefix(f, "#") {
+			continue
+		}
+		idx := strings.LastIndex(f, ":")
+		if idx <= 0 {
+			return nil, errors.New("invalid API key entry (want name:sha256hex): " + f)
+		}
+		name := strings.TrimSpace(f[:idx])
+		raw, err := hex.DecodeString(strings.TrimSpace(f[idx+1:]))
+		if err != nil || len(raw) != sha256.Size {
+			return nil, errors.New("invalid API key hash for " + name)
+		}
+		e := keyEntry{name: name}
+		copy(e.hash[:], raw)
+		ks.keys = append(ks.keys, e)
+	}
+	return ks, nil
+}
+
+// LoadKeys combines inline entries with an optional keys file.
+func LoadKeys(inline, file string) (*KeyStore, error) {
+	spec := inline
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			spec += "\n" + s.Text()
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ParseKeys(spec)
+}
+
+// Len reports the number of configured keys; zero means auth is disabled.
+func (ks *KeyStore) Len() int {
+	if ks == nil {
+		return 0
+	}
+	return len(ks.keys)
+}
+
+// Verify returns the identity for a presented key. Every entry is compared
+// in constant time so timing does not reveal which key matched.
+func (ks *KeyStore) Verify(key string) (Identity, bool) {
+	if ks == nil || key == "" {
+		return Identity{}, false
+	}
+	sum := sha256.Sum256([]byte(key))
+	var found Identity
+	ok := false
+	for _, e := range ks.keys {
+		if subtle.ConstantTimeCompare(sum[:], e.hash[:]) == 1 {
+			found = Identity{Name: e.name}
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// ParseCallerTokens reads "name:token" entries separated by commas or
+// newlines into a map keyed by caller name.
+func ParseCallerTokens(spec string) (map[string]string, error) {
+	out := map[string]string{}
+	fields := strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' })
+	for _, f := range fields {
+		f = strings.TrimSpace(f)
+		if f == "" || strings.HasPrefix(f, "#") {
+			continue
+		}
+		idx := strings.Index(f, ":")
+		if idx <= 0 || idx == len(f)-1 {
+			return nil, errors.New("invalid caller token entry (want name:token)")
+		}
+		out[strings.TrimSpace(f[:idx])] = strings.TrimSpace(f[idx+1:])
+	}
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerify(t *testing.T) {
+	ks, err := ParseKeys("alice:" + hash("alice-key") + ",\n# comment\n bob : " + hash("bob-key") + " ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", ks.Len())
+	}
+	tests := []struct {
+		name   string
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{"first key", "alice-key", "alice", true},
+		{"spaced entry", "bob-key", "bob", true},
+		{"unknown key", "mallory-key", "", false},
+		{"hash instead of key", hash("alice-key"), "", false},
+		{"empty key", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := ks.Verify(tt.key)
+			if ok != tt.wantOK || id.Name != tt.want {
+				t.Errorf("Verify(%q) = %q, %v, want %q, %v", tt.key, id.Name, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	var none *KeyStore
+	if _, ok := none.Verify("alice-key"); ok || none.Len() != 0 {
+		t.Error("a nil KeyStore accepted a key")
+	}
+}
+
+func TestParseKeysErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"no name", ":" + hash("k")},
+		{"no separator", hash("k")},
+		{"not hex", "alice:not-a-hash"},
+		{"short hash", "alice:" + hash("k")[:32]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseKeys(tt.spec); err == nil {
+				t.Errorf("ParseKeys(%q) succeeded", tt.spec)
+			}
+		})
+	}
+}
@@ -6,14 +6,21 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"bayer-chatbot-service/internal/upstream"
 )
 
 type Config struct {
 	BayerChatBaseURL     string
 	BayerChatAccessToken string
 	BayerChatProject     string
+	BayerChatTokenMode   string // service | passthrough | passthrough-with-fallback
+	CallerTokens         string // "name:token" entries: caller -> own upstream token
 	Port                 int
-	LogLevel             string
+	LogLevel             string // default level plus overrides, e.g. "info,upstream=debug"
+	LogFormat            string // json | console
+	LogOutput            string // comma-separated sinks, see logger.OpenSinks
 	DebugHTTP            bool
 	DebugHTTPBody        bool
 	DebugUpstream        bool
@@ -23,6 +30,102 @@ type Config struct {
 	CORSExposeHeaders    string
 	CORSAllowCredentials bool
 	CORSMaxAgeSeconds    int
+
+	// Log redaction rules; see logger.RedactSpec.
+	LogRedactKeys     string
+	LogRedactPaths    string
+	LogRedactPatterns string
+	LogRedactRegex    string
+	LogRedactMode     string
+
+	// Rotation for file: log outputs; zero disables each limit.
+	LogFileMaxSizeMB  int
+	LogFileMaxAge     time.Duration
+	LogFileMaxBackups int
+	LogFileRetention  time.Duration
+
+	// HTTP server lifecycle. WriteTimeout defaults to 0 because it also
+	// bounds long-lived SSE responses.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	UpstreamTimeout   time.Duration
+
+	// Upstream retry policy (idempotent GETs and stream setup only).
+	UpstreamRetryMaxAttempts int
+	UpstreamRetryBaseDelay   time.Duration
+	UpstreamRetryMaxDelay    time.Duration
+	UpstreamRetryJitter      float64
+
+	// Per-endpoint upstream circuit breaker.
+	UpstreamBreakerWindow      time.Duration
+	UpstreamBreakerMinRequests int
+	UpstreamBreakerFailureRate float64
+	UpstreamBreakerCooldown    time.Duration
+
+	// ChatAggregate makes POST /v1/chat stream from the upstream and return
+	// the aggregated result unless the request sets "aggregate".
+	ChatAggregate bool
+
+	// SSE heartbeat comment interval while a stream waits for the upstream,
+	// and the longest upstream silence before the stream fails. Zero
+	// disables each.
+	SSEHeartbeatInterval time.Duration
+	UpstreamIdleTimeout  time.Duration
+
+	// Resumable chat streams: events kept per stream for Last-Event-ID
+	// replay, how long a finished stream stays resumable (and a live one
+	// runs without followers), and how many streams are held at once.
+	StreamReplayEvents int
+	StreamRetention    time.Duration
+	StreamCapacity     int
+
+	// Concurrent generations one /v1/chat/ws connection may run.
+	WSMaxGenerations int
+
+	// Background jobs: concurrent workers, queued jobs beyond them, the
+	// directory results are kept in (in memory when empty), and how long
+	// finished jobs are kept (forever when zero).
+	JobsWorkers   int
+	JobsQueueSize int
+	JobsDir       string
+	JobsRetention time.Duration
+
+	// Directory for the file-backed conversation store.
+	ConversationsDir string
+
+	// Inbound API keys as "name:sha256hex" entries. Running without keys
+	// requires AuthDisabled.
+	APIKeys      string
+	APIKeysFile  string
+	AuthDisabled bool
+	// API-key names allowed to create, change and delete assistants.
+	AdminKeys string
+
+	// Inbound rate limits; zero disables each limit.
+	RateLimitRPS            float64
+	RateLimitBurst          int
+	RateLimitModelRPS       float64
+	RateLimitModelBurst     int
+	MaxStreamsPerCaller     int
+	MaxStreamsPerModel      int
+	RateLimitTrustForwarded bool
+
+	// MetricsEnabled serves Prometheus metrics at /metrics.
+	MetricsEnabled bool
+
+	// ReadyzProbeInterval is how long an upstream probe result is reused by
+	// /readyz; ReadyzProbeTimeout bounds each probe.
+	ReadyzProbeInterval time.Duration
+	ReadyzProbeTimeout  time.Duration
+
+	// Tracing. Spans go to the OTLP/HTTP collector when an endpoint is set
+	// and are logged at debug level otherwise.
+	OTLPEndpoint string
+	OTLPHeaders  string
+	ServiceName  string
 }
 
 func (c Config) Addr() string {
@@ -35,25 +138,101 @@ func FromEnv() (Config, error) {
 	cfg.BayerChatBaseURL = getenvDefault("BAYER_CHAT_BASE_URL", "https://chat.int.bayer.com/api/v2")
 	cfg.BayerChatAccessToken = os.Getenv("BAYER_CHAT_ACCESS_TOKEN")
 	cfg.BayerChatProject = os.Getenv("BAYER_CHAT_PROJECT")
+	cfg.BayerChatTokenMode = strings.ToLower(getenvDefault("BAYER_CHAT_TOKEN_MODE", "service"))
+	cfg.CallerTokens = os.Getenv("CALLER_TOKENS")
 
 	cfg.Port = getenvIntDefault("PORT", 8787)
 	cfg.LogLevel = strings.ToLower(getenvDefault("LOG_LEVEL", "info"))
+	cfg.LogFormat = strings.ToLower(getenvDefault("LOG_FORMAT", "json"))
+	cfg.LogOutput = getenvDefault("LOG_OUTPUT", "split")
+	cfg.LogRedactKeys = getenvSetDefault("LOG_REDACT_KEYS", "authorization,cookie,set-cookie,x-api-key,x-baychatgpt-accesstoken,password")
+	cfg.LogRedactPaths = getenvSetDefault("LOG_REDACT_PATHS", "messages[*].content")
+	cfg.LogRedactPatterns = getenvSetDefault("LOG_REDACT_PATTERNS", "email,iban,bearer")
+	cfg.LogRedactRegex = os.Getenv("LOG_REDACT_REGEX")
+	cfg.LogRedactMode = getenvDefault("LOG_REDACT_MODE", "mask")
+	cfg.LogFileMaxSizeMB = getenvIntDefault("LOG_FILE_MAX_SIZE_MB", 100)
+	cfg.LogFileMaxAge = getenvDurationDefault("LOG_FILE_MAX_AGE", 24*time.Hour)
+	cfg.LogFileMaxBackups = getenvIntDefault("LOG_FILE_MAX_BACKUPS", 7)
+	cfg.LogFileRetention = getenvDurationDefault("LOG_FILE_RETENTION", 0)
 	cfg.DebugHTTP = getenvBoolDefault("DEBUG_HTTP", false)
 	cfg.DebugHTTPBody = getenvBoolDefault("DEBUG_HTTP_BODY", false)
 	cfg.DebugUpstream = getenvBoolDefault("DEBUG_UPSTREAM", false)
 
 	// Simple permissive CORS (matches current TS behavior: app.use(cors())).
 	cfg.CORSAllowOrigin = getenvDefault("CORS_ALLOW_ORIGIN", "*")
-	cfg.CORSAllowHeaders = getenvDefault("CORS_ALLOW_HEADERS", "content-type,x-request-id")
-	cfg.CORSAllowMethods = getenvDefault("CORS_ALLOW_METHODS", "GET,POST,OPTIONS")
-	cfg.CORSExposeHeaders = getenvDefault("CORS_EXPOSE_HEADERS", "x-request-id")
+	cfg.CORSAllowHeaders = getenvDefault("CORS_ALLOW_HEADERS", "authorization,content-type,x-request-id,x-baychatgpt-accesstoken")
+	cfg.CORSAllowMethods = getenvDefault("CORS_ALLOW_METHODS", "GET,POST,PATCH,DELETE,OPTIONS")
+	cfg.CORSExposeHeaders = getenvDefault("CORS_EXPOSE_HEADERS", "x-request-id,x-stream-id,x-upstream-attempts,retry-after,x-ratelimit-limit,x-ratelimit-remaining,x-ratelimit-reset")
 	cfg.CORSAllowCredentials = getenvBoolDefault("CORS_ALLOW_CREDENTIALS", false)
 	cfg.CORSMaxAgeSeconds = getenvIntDefault("CORS_MAX_AGE", 600)
 
-	if cfg.BayerChatAccessToken == "" {
+	cfg.ReadHeaderTimeout = getenvDurationDefault("HTTP_READ_HEADER_TIMEOUT", 10*time.Second)
+	cfg.ReadTimeout = getenvDurationDefault("HTTP_READ_TIMEOUT", 30*time.Second)
+	cfg.WriteTimeout = getenvDurationDefault("HTTP_WRITE_TIMEOUT", 0)
+	cfg.IdleTimeout = getenvDurationDefault("HTTP_IDLE_TIMEOUT", 120*time.Second)
+	cfg.ShutdownTimeout = getenvDurationDefault("SHUTDOWN_TIMEOUT", 30*time.Second)
+	// The upstream timeout covers the full response body, including streams.
+	cfg.UpstreamTimeout = getenvDurationDefault("UPSTREAM_TIMEOUT", 0)
+
+	cfg.UpstreamRetryMaxAttempts = getenvIntDefault("UPSTREAM_RETRY_MAX_ATTEMPTS", 3)
+	cfg.UpstreamRetryBaseDelay = getenvDurationDefault("UPSTREAM_RETRY_BASE_DELAY", 200*time.Millisecond)
+	cfg.UpstreamRetryMaxDelay = getenvDurationDefault("UPSTREAM_RETRY_MAX_DELAY", 5*time.Second)
+	cfg.UpstreamRetryJitter = getenvFloatDefault("UPSTREAM_RETRY_JITTER", 0.5)
+
+	cfg.UpstreamBreakerWindow = getenvDurationDefault("UPSTREAM_BREAKER_WINDOW", 30*time.Second)
+	cfg.UpstreamBreakerMinRequests = getenvIntDefault("UPSTREAM_BREAKER_MIN_REQUESTS", 5)
+	cfg.UpstreamBreakerFailureRate = getenvFloatDefault("UPSTREAM_BREAKER_FAILURE_RATE", 0.5)
+	cfg.UpstreamBreakerCooldown = getenvDurationDefault("UPSTREAM_BREAKER_COOLDOWN", 15*time.Second)
+
+	cfg.ChatAggregate = getenvBoolDefault("CHAT_AGGREGATE", false)
+	cfg.SSEHeartbeatInterval = getenvDurationDefault("SSE_HEARTBEAT_INTERVAL", 15*time.Second)
+	cfg.UpstreamIdleTimeout = getenvDurationDefault("UPSTREAM_IDLE_TIMEOUT", 5*time.Minute)
+	cfg.StreamReplayEvents = getenvIntDefault("STREAM_REPLAY_EVENTS", 1000)
+	cfg.StreamRetention = getenvDurationDefault("STREAM_RETENTION", 2*time.Minute)
+	cfg.StreamCapacity = getenvIntDefault("STREAM_CAPACITY", 1000)
+	cfg.WSMaxGenerations = getenvIntDefault("WS_MAX_GENERATIONS", 4)
+
+	cfg.JobsWorkers = getenvIntDefault("JOBS_WORKERS", 4)
+	cfg.JobsQueueSize = getenvIntDefault("JOBS_QUEUE_SIZE", 64)
+	cfg.JobsDir = getenvSetDefault("JOBS_DIR", "data/jobs")
+	cfg.JobsRetention = getenvDurationDefault("JOBS_RETENTION", 24*time.Hour)
+
+	cfg.ConversationsDir = getenvDefault("CONVERSATIONS_DIR", "data/conversations")
+
+	cfg.APIKeys = os.Getenv("API_KEYS")
+	cfg.APIKeysFile = os.Getenv("API_KEYS_FILE")
+	cfg.AuthDisabled = getenvBoolDefault("AUTH_DISABLED", false)
+	cfg.AdminKeys = os.Getenv("ADMIN_KEYS")
+
+	cfg.RateLimitRPS = getenvFloatDefault("RATE_LIMIT_RPS", 0)
+	cfg.RateLimitBurst = getenvIntDefault("RATE_LIMIT_BURST", 0)
+	cfg.RateLimitModelRPS = getenvFloatDefault("RATE_LIMIT_MODEL_RPS", 0)
+	cfg.RateLimitModelBurst = getenvIntDefault("RATE_LIMIT_MODEL_BURST", 0)
+	cfg.MaxStreamsPerCaller = getenvIntDefault("MAX_STREAMS_PER_CALLER", 0)
+	cfg.MaxStreamsPerModel = getenvIntDefault("MAX_STREAMS_PER_MODEL", 0)
+	cfg.RateLimitTrustForwarded = getenvBoolDefault("RATE_LIMIT_TRUST_FORWARDED", false)
+	cfg.MetricsEnabled = getenvBoolDefault("METRICS_ENABLED", true)
+	cfg.ReadyzProbeInterval = getenvDurationDefault("READYZ_PROBE_INTERVAL", 15*time.Second)
+	cfg.ReadyzProbeTimeout = getenvDurationDefault("READYZ_PROBE_TIMEOUT", 5*time.Second)
+	cfg.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	cfg.OTLPHeaders = os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
+	cfg.ServiceName = getenvDefault("OTEL_SERVICE_NAME", "bayer-chatbot-service")
+
+	if !upstream.ValidTokenMode(cfg.BayerChatTokenMode) {
+		return Config{}, errors.New("Invalid environment: BAYER_CHAT_TOKEN_MODE: must be service, passthrough or passthrough-with-fallback")
+	}
+	// Passthrough calls always carry the caller's own token.
+	if cfg.BayerChatTokenMode != upstream.TokenModePassthrough && cfg.BayerChatAccessToken == "" {
 		return Config{}, errors.New("Invalid environment: BAYER_CHAT_ACCESS_TOKEN: required")
 	}
 
+	switch {
+	case cfg.AuthDisabled && (cfg.APIKeys != "" || cfg.APIKeysFile != ""):
+		return Config{}, errors.New("Invalid environment: AUTH_DISABLED: must not be set together with API_KEYS or API_KEYS_FILE")
+	case !cfg.AuthDisabled && cfg.APIKeys == "" && cfg.APIKeysFile == "":
+		return Config{}, errors.New("Invalid environment: API_KEYS: required unless AUTH_DISABLED=true")
+	}
+
 	return cfg, nil
 }
 
@@ -65,6 +244,15 @@ func getenvDefault(key, def string) string {
 	return v
 }
 
+// getenvSetDefault is like getenvDefault but keeps an explicitly empty value,
+// so lists with non-empty defaults can be switched off.
+func getenvSetDefault(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
 func getenvIntDefault(key string, def int) int {
 	v := os.Getenv(key)
 	if v == "" {
@@ -77,6 +265,35 @@ func getenvIntDefault(key string, def int) int {
 	return i
 }
 
+func getenvFloatDefault(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+// getenvDurationDefault accepts Go duration strings ("30s", "2m") or a plain
+// integer number of seconds.
+func getenvDurationDefault(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	if i, err := strconv.Atoi(v); err == nil {
+		return time.Duration(i) * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def
+	}
+	return d
+}
+
 func getenvBoolDefault(key string, def bool) bool {
 	v := strings.TrimSpace(strings.ToLower(os.Getenv(key)))
 	if v == "" {
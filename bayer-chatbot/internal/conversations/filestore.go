@@ -0,0 +1,181 @@
+package conversations
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps one JSON document per conversation in a directory. Writes
+// go through a temp file and rename so a crash never leaves a torn file.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Create(ctx context.Context, owner, title string) (Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	c := Conversation{
+		ID:        newID(),
+		Owner:     owner,
+		Title:     title,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Messages:  []Message{},
+	}
+	if err := s.write(c); err != nil {
+		return Conversation{}, err
+	}
+	return c, nil
+}
+
+func (s *FileStore) List(ctx context.Context, owner string) ([]Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Summary, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		c, err := s.read(strings.TrimSuffix(name, ".json"), owner)
+		if err != nil {
+			continue
+		}
+		out = append(out, c.Summary())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return out, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, id, owner string) (Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(id, owner)
+}
+
+func (s *FileStore) Rename(ctx context.Context, id, owner, title string) (Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.read(id, owner)
+	if err != nil {
+		return Conversation{}, err
+	}
+	c.Title = title
+	c.UpdatedAt = time.Now().UTC()
+	if err := s.write(c); err != nil {
+		return Conversation{}, err
+	}
+	return c, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, id, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.read(id, owner); err != nil {
+		return err
+	}
+	err := os.Remove(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *FileStore) Append(ctx context.Context, id, owner string, msgs ...Message) (Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.read(id, owner)
+	if err != nil {
+		return Conversation{}, err
+	}
+	now := time.Now().UTC()
+	for _, m := range msgs {
+		if m.ID == "" {
+			m.ID = newID()
+		}
+		if m.CreatedAt.IsZero() {
+			m.CreatedAt = now
+		}
+		c.Messages = append(c.Messages, m)
+	}
+	c.UpdatedAt = now
+	if err := s.write(c); err != nil {
+		return Conversation{}, err
+	}
+	return c, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// read loads the conversation with id; one of another owner is reported as
+// ErrNotFound so its existence is not revealed.
+func (s *FileStore) read(id, owner string) (Conversation, error) {
+	if !validID(id) {
+		return Conversation{}, ErrNotFound
+	}
+	b, err := os.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return Conversation{}, ErrNotFound
+	}
+	if err != nil {
+		return Conversation{}, err
+	}
+	var c Conversation
+	if err := json.Unmarshal(b, &c); err != nil {
+		return Conversation{}, err
+	}
+	if c.Owner != owner {
+		return Conversation{}, ErrNotFound
+	}
+	if c.Messages == nil {
+		c.Messages = []Message{}
+	}
+	return c, nil
+}
+
+func (s *FileStore) write(c Conversation) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, c.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(c.ID))
+}
@@ -0,0 +1,44 @@
+package conversations
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFileStoreScopesToOwner(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Create(ctx, "alice", "mine")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if list, _ := s.List(ctx, "bob"); len(list) != 0 {
+		t.Errorf("bob lists %d conversations, want 0", len(list))
+	}
+	if list, _ := s.List(ctx, "alice"); len(list) != 1 {
+		t.Errorf("alice lists %d conversations, want 1", len(list))
+	}
+
+	other := map[string]func() error{
+		"Get":              func() error { _, err := s.Get(ctx, c.ID, "bob"); return err },
+		"Rename":           func() error { _, err := s.Rename(ctx, c.ID, "bob", "x"); return err },
+		"Append":           func() error { _, err := s.Append(ctx, c.ID, "bob", Message{Role: "user", Content: "x"}); return err },
+		"Delete":           func() error { return s.Delete(ctx, c.ID, "bob") },
+		"Get without auth": func() error { _, err := s.Get(ctx, c.ID, ""); return err },
+	}
+	for name, call := range other {
+		if err := call(); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s by another owner: err = %v, want ErrNotFound", name, err)
+		}
+	}
+
+	got, err := s.Get(ctx, c.ID, "alice")
+	if err != nil || got.Title != "mine" || len(got.Messages) != 0 {
+		t.Errorf("Get by owner = %+v, %v; want the untouched conversation", got, err)
+	}
+}
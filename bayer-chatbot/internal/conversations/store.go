@@ -0,0 +1,81 @@
+// Package conversations persists chat threads on the server so they survive
+// reloads and can be shared between devices.
+package conversations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for unknown conversation ids.
+var ErrNotFound = errors.New("conversation not found")
+
+type Message struct {
+	ID        string    `json:"id"`
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Conversation struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner,omitempty"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Messages  []Message `json:"messages"`
+}
+
+// Summary is the list view of a conversation, without its messages.
+type Summary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	MessageCount int       `json:"messageCount"`
+}
+
+func (c Conversation) Summary() Summary {
+	return Summary{
+		ID:           c.ID,
+		Title:        c.Title,
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		MessageCount: len(c.Messages),
+	}
+}
+
+// Store is implemented by conversation backends. Every method is scoped to
+// owner: conversations of other owners are not listed and are ErrNotFound
+// otherwise. List returns the most recently updated conversations first.
+// Append assigns ids and timestamps to messages that lack them.
+type Store interface {
+	Create(ctx context.Context, owner, title string) (Conversation, error)
+	List(ctx context.Context, owner string) ([]Summary, error)
+	Get(ctx context.Context, id, owner string) (Conversation, error)
+	Rename(ctx context.Context, id, owner, title string) (Conversation, error)
+	Delete(ctx context.Context, id, owner string) error
+	Append(ctx context.Context, id, owner string, msgs ...Message) (Conversation, error)
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validID guards file names: ids are always lowercase hex from newID.
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, r := range id {
+		if !((r >= '0' && r <= '9') || (r >= 'a' && r <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
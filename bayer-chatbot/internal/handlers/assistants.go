@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// Assistant field limits.
+const (
+	maxAssistantNameChars  = 128
+	maxDescriptionChars    = 2000
+	maxInstructionsChars   = 32000
+	maxAssistantRoleChars  = 32
+	maxEmailChars          = 254
+	maxAssistantsPageLimit = 100
+	assistantBodyLimit     = 256 << 10
+	assistantUserBodyLimit = 16 << 10
+)
+
+// Assistant is a myGenAssist assistant. Fields beyond the known ones are
+// kept as the upstream sent them.
+type Assistant struct {
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	Model        string                 `json:"model,omitempty"`
+	Instructions string                 `json:"instructions,omitempty"`
+	ToolKeys     []string               `json:"tool_keys,omitempty"`
+	Extra        map[string]interface{} `json:"-"`
+}
+
+func (a Assistant) MarshalJSON() ([]byte, error) {
+	type plain Assistant
+	return marshalWithExtra(plain(a), a.Extra)
+}
+
+// AssistantList is the response of GET /v1/assistants.
+type AssistantList struct {
+	Object string      `json:"object"`
+	Data   []Assistant `json:"data"`
+}
+
+// AssistantInput is the body of POST /v1/assistants.
+type AssistantInput struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Model        string   `json:"model"`
+	Instructions string   `json:"instructions,omitempty"`
+	ToolKeys     []string `json:"tool_keys,omitempty"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+}
+
+// AssistantUpdate is the body of PATCH /v1/assistants/{assistantId}. Absent
+// fields are left unchanged; "tool_keys": [] removes every tool.
+type AssistantUpdate struct {
+	Name         *string   `json:"name,omitempty"`
+	Description  *string   `json:"description,omitempty"`
+	Model        *string   `json:"model,omitempty"`
+	Instructions *string   `json:"instructions,omitempty"`
+	ToolKeys     *[]string `json:"tool_keys,omitempty"`
+	Temperature  *float64  `json:"temperature,omitempty"`
+}
+
+// AssistantUser is one entry of GET /v1/assistants/{assistantId}/users.
+// Fields beyond the known ones are kept as the upstream sent them.
+type AssistantUser struct {
+	ID    string                 `json:"id,omitempty"`
+	Email string                 `json:"email,omitempty"`
+	Name  string                 `json:"name,omitempty"`
+	Role  string                 `json:"role,omitempty"`
+	Extra map[string]interface{} `json:"-"`
+}
+
+func (u AssistantUser) MarshalJSON() ([]byte, error) {
+	type plain AssistantUser
+	return marshalWithExtra(plain(u), u.Extra)
+}
+
+// AssistantUserList is the response of GET /v1/assistants/{assistantId}/users.
+type AssistantUserList struct {
+	Object string          `json:"object"`
+	Data   []AssistantUser `json:"data"`
+}
+
+// AssistantUserInput is the body of POST /v1/assistants/{assistantId}/users.
+type AssistantUserInput struct {
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"`
+}
+
+// Tool is one entry of GET /v1/tools; Key is what chat requests pass in
+// tool_keys.
+type Tool struct {
+	Key         string                 `json:"key"`
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Extra       map[string]interface{} `json:"-"`
+}
+
+func (t Tool) MarshalJSON() ([]byte, error) {
+	type plain Tool
+	return marshalWithExtra(plain(t), t.Extra)
+}
+
+// ToolList is the response of GET /v1/tools.
+type ToolList struct {
+	Object string `json:"object"`
+	Data   []Tool `json:"data"`
+}
+
+func (in *AssistantInput) validate() []utils.FieldError {
+	var v violations
+	if strings.TrimSpace(in.Name) == "" {
+		v.add("name", "is required")
+	}
+	if in.Model == "" {
+		v.add("model", "is required")
+	}
+	v = append(v, validateAssistantFields(&in.Name, &in.Description, &in.Model, &in.Instructions, in.ToolKeys, in.Temperature)...)
+	return v
+}
+
+func (in *AssistantUpdate) validate() []utils.FieldError {
+	var v violations
+	if in.Name == nil && in.Description == nil && in.Model == nil && in.Instructions == nil && in.ToolKeys == nil && in.Temperature == nil {
+		v.add("body", "must set at least one field")
+		return v
+	}
+	if in.Name != nil && strings.TrimSpace(*in.Name) == "" {
+		v.add("name", "must not be empty")
+	}
+	if in.Model != nil && *in.Model == "" {
+		v.add("model", "must not be empty")
+	}
+	var keys []string
+	if in.ToolKeys != nil {
+		keys = *in.ToolKeys
+	}
+	v = append(v, validateAssistantFields(in.Name, in.Description, in.Model, in.Instructions, keys, in.Temperature)...)
+	return v
+}
+
+// validateAssistantFields checks the limits shared by create and update;
+// nil pointers are skipped.
+func validateAssistantFields(name, description, model, instructions *string, toolKeys []string, temperature *float64) []utils.FieldError {
+	var v violations
+	if name != nil {
+		v.maxChars("name", *name, maxAssistantNameChars)
+	}
+	if description != nil {
+		v.maxChars("description", *description, maxDescriptionChars)
+	}
+	if model != nil {
+		v.maxChars("model", *model, maxIDChars)
+	}
+	if instructions != nil {
+		v.maxChars("instructions", *instructions, maxInstructionsChars)
+	}
+	if len(toolKeys) > maxToolKeys {
+		v.add("tool_keys", "must contain at most "+strconv.Itoa(maxToolKeys)+" entries")
+	}
+	for i, k := range toolKeys {
+		p := "tool_keys[" + strconv.Itoa(i) + "]"
+		if k == "" {
+			v.add(p, "must not be empty")
+		}
+		v.maxChars(p, k, maxIDChars)
+	}
+	if temperature != nil && (*temperature < 0 || *temperature > maxTemperature) {
+		v.add("temperature", "must be between 0 and "+strconv.Itoa(maxTemperature))
+	}
+	return v
+}
+
+func (in *AssistantUserInput) validate() []utils.FieldError {
+	var v violations
+	at := strings.IndexByte(in.Email, '@')
+	switch {
+	case in.Email == "":
+		v.add("email", "is required")
+	case at < 1 || at == len(in.Email)-1 || strings.ContainsAny(in.Email, " \t\r\n"):
+		v.add("email", "must be an email address")
+	}
+	v.maxChars("email", in.Email, maxEmailChars)
+	v.maxChars("role", in.Role, maxAssistantRoleChars)
+	return v
+}
+
+// assistantListQuery validates the paging parameters of GET /v1/assistants
+// and returns the ones to forward.
+func assistantListQuery(q url.Values) (url.Values, []utils.FieldError) {
+	var v violations
+	out := url.Values{}
+	names := make([]string, 0, len(q))
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case "limit", "offset", "search":
+		default:
+			v.add(name, "is not a known query parameter; use limit, offset or search")
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n < 1 || n > maxAssistantsPageLimit {
+			v.add("limit", "must be an integer between 1 and "+strconv.Itoa(maxAssistantsPageLimit))
+		} else {
+			out.Set("limit", s)
+		}
+	}
+	if s := q.Get("offset"); s != "" {
+		if n, err := strconv.Atoi(s); err != nil || n < 0 {
+			v.add("offset", "must be a non-negative integer")
+		} else {
+			out.Set("offset", s)
+		}
+	}
+	if s := q.Get("search"); s != "" {
+		v.maxChars("search", s, maxAssistantNameChars)
+		out.Set("search", s)
+	}
+	return out, v
+}
+
+// ListAssistants serves GET /v1/assistants.
+func (h *Handler) ListAssistants(w http.ResponseWriter, r *http.Request) {
+	query, problems := assistantListQuery(r.URL.Query())
+	if len(problems) > 0 {
+		writeValidationError(w, r, problems)
+		return
+	}
+	body, err := h.client.ListAssistants(r.Context(), query, r.Header.Get("x-request-id"))
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	items, ok := listItems(body, "data", "assistants", "items")
+	if !ok {
+		h.writeUpstreamError(w, r, badUpstreamBody(body, "assistant list"))
+		return
+	}
+	list := AssistantList{Object: "list", Data: make([]Assistant, 0, len(items))}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			list.Data = append(list.Data, assistantFrom(m))
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, list)
+}
+
+// GetAssistant serves GET /v1/assistants/{assistantId}.
+func (h *Handler) GetAssistant(w http.ResponseWriter, r *http.Request) {
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	body, err := h.client.GetAssistant(r.Context(), id, r.Header.Get("x-request-id"))
+	h.writeAssistant(w, r, http.StatusOK, body, err)
+}
+
+// CreateAssistant serves POST /v1/assistants.
+func (h *Handler) CreateAssistant(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAllowed(w, r) {
+		return
+	}
+	var in AssistantInput
+	if !decodeBody(w, r, assistantBodyLimit, &in, in.validate) {
+		return
+	}
+	payload, _ := json.Marshal(in)
+	body, err := h.client.CreateAssistant(r.Context(), payload, r.Header.Get("x-request-id"))
+	h.writeAssistant(w, r, http.StatusCreated, body, err)
+}
+
+// UpdateAssistant serves PATCH /v1/assistants/{assistantId}.
+func (h *Handler) UpdateAssistant(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAllowed(w, r) {
+		return
+	}
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	var in AssistantUpdate
+	if !decodeBody(w, r, assistantBodyLimit, &in, in.validate) {
+		return
+	}
+	payload, _ := json.Marshal(in)
+	body, err := h.client.UpdateAssistant(r.Context(), id, payload, r.Header.Get("x-request-id"))
+	h.writeAssistant(w, r, http.StatusOK, body, err)
+}
+
+// DeleteAssistant serves DELETE /v1/assistants/{assistantId}.
+func (h *Handler) DeleteAssistant(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAllowed(w, r) {
+		return
+	}
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	if err := h.client.DeleteAssistant(r.Context(), id, r.Header.Get("x-request-id")); err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AssistantUsers serves GET /v1/assistants/{assistantId}/users.
+func (h *Handler) AssistantUsers(w http.ResponseWriter, r *http.Request) {
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	body, err := h.client.ListAssistantUsers(r.Context(), id, r.Header.Get("x-request-id"))
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	items, ok := listItems(body, "data", "users")
+	if !ok {
+		h.writeUpstreamError(w, r, badUpstreamBody(body, "user list"))
+		return
+	}
+	list := AssistantUserList{Object: "list", Data: make([]AssistantUser, 0, len(items))}
+	for _, item := range items {
+		if m, ok := item.(map[string]interface{}); ok {
+			list.Data = append(list.Data, assistantUserFrom(m))
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, list)
+}
+
+// AddAssistantUser serves POST /v1/assistants/{assistantId}/users.
+func (h *Handler) AddAssistantUser(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAllowed(w, r) {
+		return
+	}
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	var in AssistantUserInput
+	if !decodeBody(w, r, assistantUserBodyLimit, &in, in.validate) {
+		return
+	}
+	payload, _ := json.Marshal(in)
+	body, err := h.client.AddAssistantUser(r.Context(), id, payload, r.Header.Get("x-request-id"))
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	// Echo the input when the upstream answers without a user.
+	u := AssistantUser{Email: in.Email, Role: in.Role}
+	if m, ok := objectBody(body); ok && len(m) > 0 {
+		u = assistantUserFrom(m)
+	}
+	utils.WriteJSON(w, http.StatusCreated, u)
+}
+
+// RemoveAssistantUser serves DELETE /v1/assistants/{assistantId}/users/{userId}.
+func (h *Handler) RemoveAssistantUser(w http.ResponseWriter, r *http.Request) {
+	if !h.adminAllowed(w, r) {
+		return
+	}
+	id, ok := assistantIDParam(w, r)
+	if !ok {
+		return
+	}
+	userID := r.PathValue("userId")
+	if problems := validPathID("userId", userID); len(problems) > 0 {
+		writeValidationError(w, r, problems)
+		return
+	}
+	if err := h.client.RemoveAssistantUser(r.Context(), id, userID, r.Header.Get("x-request-id")); err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminAllowed answers 403 unless the caller may change assistants. Changes
+// run with the service's upstream token, so they are limited to the API keys
+// in ADMIN_KEYS; in passthrough mode the upstream checks the caller's own
+// token instead. Without auth there is no caller to allow.
+func (h *Handler) adminAllowed(w http.ResponseWriter, r *http.Request) bool {
+	if h.cfg.BayerChatTokenMode == upstream.TokenModePassthrough {
+		return true
+	}
+	if name := callerName(r); name != "" && h.admins[name] {
+		return true
+	}
+	writeError(w, r, http.StatusForbidden, "forbidden", "changing assistants requires an API key listed in ADMIN_KEYS")
+	return false
+}
+
+// ListTools serves GET /v1/tools.
+func (h *Handler) ListTools(w http.ResponseWriter, r *http.Request) {
+	body, err := h.client.ListTools(r.Context(), r.Header.Get("x-request-id"))
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	items, ok := listItems(body, "data", "tools")
+	if !ok {
+		h.writeUpstreamError(w, r, badUpstreamBody(body, "tool list"))
+		return
+	}
+	list := ToolList{Object: "list", Data: make([]Tool, 0, len(items))}
+	for _, item := range items {
+		t := Tool{}
+		switch x := item.(type) {
+		case string:
+			t.Key = x
+		case map[string]interface{}:
+			t = Tool{
+				Key:         firstString(x, "key", "tool_key", "id", "name"),
+				Name:        firstString(x, "name", "display_name"),
+				Description: firstString(x, "description"),
+				Extra:       x,
+			}
+			for _, k := range []string{"key", "name", "description"} {
+				delete(x, k)
+			}
+		}
+		if t.Key != "" {
+			list.Data = append(list.Data, t)
+		}
+	}
+	utils.WriteJSON(w, http.StatusOK, list)
+}
+
+func assistantIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("assistantId")
+	if problems := validPathID("assistantId", id); len(problems) > 0 {
+		writeValidationError(w, r, problems)
+		return "", false
+	}
+	return id, true
+}
+
+// writeAssistant answers with the assistant in an upstream response body.
+func (h *Handler) writeAssistant(w http.ResponseWriter, r *http.Request, status int, body []byte, err error) {
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	m, ok := objectBody(body)
+	if !ok {
+		h.writeUpstreamError(w, r, badUpstreamBody(body, "assistant"))
+		return
+	}
+	utils.WriteJSON(w, status, assistantFrom(m))
+}
+
+// objectBody decodes a JSON object, unwrapping {"data": {...}}.
+func objectBody(body []byte) (map[string]interface{}, bool) {
+	var m map[string]interface{}
+	if json.Unmarshal(body, &m) != nil || m == nil {
+		return nil, false
+	}
+	if inner, ok := m["data"].(map[string]interface{}); ok && len(m) == 1 {
+		return inner, true
+	}
+	return m, true
+}
+
+func assistantFrom(m map[string]interface{}) Assistant {
+	a := Assistant{
+		ID:           firstString(m, "id", "assistant_id"),
+		Name:         firstString(m, "name"),
+		Description:  firstString(m, "description"),
+		Model:        firstString(m, "model"),
+		Instructions: firstString(m, "instructions", "system_prompt"),
+		Extra:        m,
+	}
+	if keys, ok := m["tool_keys"].([]interface{}); ok {
+		for _, k := range keys {
+			if s, ok := k.(string); ok {
+				a.ToolKeys = append(a.ToolKeys, s)
+			}
+		}
+	}
+	for _, k := range []string{"id", "name", "description", "model", "instructions", "tool_keys"} {
+		delete(m, k)
+	}
+	return a
+}
+
+func assistantUserFrom(m map[string]interface{}) AssistantUser {
+	u := AssistantUser{
+		ID:    firstString(m, "id", "user_id"),
+		Email: firstString(m, "email"),
+		Name:  firstString(m, "name", "display_name"),
+		Role:  firstString(m, "role"),
+		Extra: m,
+	}
+	for _, k := range []string{"id", "email", "name", "role"} {
+		delete(m, k)
+	}
+	return u
+}
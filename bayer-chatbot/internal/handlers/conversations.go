@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// ConversationInput is the body of POST /v1/conversations and
+// PATCH /v1/conversations/{conversationId}.
+type ConversationInput struct {
+	Title string `json:"title,omitempty"`
+}
+
+// AppendMessagesInput is the body of
+// POST /v1/conversations/{conversationId}/messages.
+type AppendMessagesInput struct {
+	Messages []ChatMessage `json:"messages"`
+}
+
+// ConversationList is the response of GET /v1/conversations.
+type ConversationList struct {
+	Data []conversations.Summary `json:"data"`
+}
+
+// storeReady answers 501 when no conversation store is configured.
+func (h *Handler) storeReady(w http.ResponseWriter, r *http.Request) bool {
+	if h.conversations == nil {
+		writeError(w, r, http.StatusNotImplemented, "not_implemented", "conversation store is not configured")
+		return false
+	}
+	return true
+}
+
+// ListConversations serves GET /v1/conversations.
+func (h *Handler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	list, err := h.conversations.List(r.Context(), callerName(r))
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, ConversationList{Data: list})
+}
+
+// CreateConversation serves POST /v1/conversations.
+func (h *Handler) CreateConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	var in ConversationInput
+	if !decodeBody(w, r, 64<<10, &in, nil) {
+		return
+	}
+	c, err := h.conversations.Create(r.Context(), callerName(r), strings.TrimSpace(in.Title))
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, c)
+}
+
+// GetConversation serves GET /v1/conversations/{conversationId}.
+func (h *Handler) GetConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	c, err := h.conversations.Get(r.Context(), r.PathValue("conversationId"), callerName(r))
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, c)
+}
+
+// RenameConversation serves PATCH /v1/conversations/{conversationId}.
+func (h *Handler) RenameConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	var in ConversationInput
+	if !decodeBody(w, r, 64<<10, &in, nil) {
+		return
+	}
+	c, err := h.conversations.Rename(r.Context(), r.PathValue("conversationId"), callerName(r), strings.TrimSpace(in.Title))
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, c)
+}
+
+// DeleteConversation serves DELETE /v1/conversations/{conversationId}.
+func (h *Handler) DeleteConversation(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	if err := h.conversations.Delete(r.Context(), r.PathValue("conversationId"), callerName(r)); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AppendMessages serves POST /v1/conversations/{conversationId}/messages.
+func (h *Handler) AppendMessages(w http.ResponseWriter, r *http.Request) {
+	if !h.storeReady(w, r) {
+		return
+	}
+	id := r.PathValue("conversationId")
+	var in AppendMessagesInput
+	if !decodeBody(w, r, chatBodyLimit, &in, func() []utils.FieldError { return validateMessages("messages", in.Messages) }) {
+		return
+	}
+
+	msgs := make([]conversations.Message, 0, len(in.Messages))
+	for _, m := range in.Messages {
+		msgs = append(msgs, conversations.Message{Role: m.Role, Content: m.Content})
+	}
+
+	c, err := h.conversations.Append(r.Context(), id, callerName(r), msgs...)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusCreated, c)
+}
+
+func (h *Handler) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, conversations.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "not_found", err.Error())
+		return
+	}
+	var invalid errString
+	if errors.As(err, &invalid) {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	h.logr.Ctx(r.Context()).Error("conversations.error", map[string]interface{}{
+		"error": err.Error(),
+	})
+	writeError(w, r, http.StatusInternalServerError, "internal_error", "conversation store failed")
+}
+
+// loadConversation resolves req.ConversationID among owner's conversations.
+// When set, the stored history is prepended to req.Messages and the new
+// messages are returned so they can be persisted with the reply.
+func (h *Handler) loadConversation(ctx context.Context, owner string, req *ChatRequest) (string, []conversations.Message, error) {
+	id := req.ConversationID
+	if id == "" {
+		return "", nil, nil
+	}
+	if h.conversations == nil {
+		return "", nil, errString("conversation store is not configured")
+	}
+
+	c, err := h.conversations.Get(ctx, id, owner)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fresh := make([]conversations.Message, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		fresh = append(fresh, conversations.Message{Role: m.Role, Content: m.Content})
+	}
+
+	history := make([]ChatMessage, 0, len(c.Messages)+len(req.Messages))
+	for _, m := range c.Messages {
+		history = append(history, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	req.Messages = append(history, req.Messages...)
+
+	return id, fresh, nil
+}
+
+// saveTurn appends the caller's new messages and the assistant reply. It uses
+// a fresh context because the request may already be finished.
+func (h *Handler) saveTurn(r *http.Request, id string, fresh []conversations.Message, reply string) {
+	if id == "" {
+		return
+	}
+	msgs := append(fresh, conversations.Message{Role: "assistant", Content: reply})
+	if _, err := h.conversations.Append(context.Background(), id, callerName(r), msgs...); err != nil {
+		h.logr.Ctx(r.Context()).Error("conversations.save_error", map[string]interface{}{
+			"conversationId": id,
+			"error":          err.Error(),
+		})
+	}
+}
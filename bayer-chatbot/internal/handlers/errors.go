@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// ErrorBody is the single JSON error envelope used by every route.
+type ErrorBody struct {
+	Error     string             `json:"error"`
+	Message   string             `json:"message"`
+	RequestID string             `json:"requestId,omitempty"`
+	Retryable bool               `json:"retryable,omitempty"`
+	Upstream  *UpstreamErrorInfo `json:"upstream,omitempty"`
+	Details   []utils.FieldError `json:"details,omitempty"`
+}
+
+type UpstreamErrorInfo struct {
+	Status    int    `json:"status,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestId,omitempty"`
+	Body      string `json:"body,omitempty"`
+}
+
+// writeError writes the error envelope for a failure produced by this service.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	utils.WriteJSON(w, status, ErrorBody{
+		Error:     code,
+		Message:   message,
+		RequestID: r.Header.Get("x-request-id"),
+	})
+}
+
+// writeValidationError answers 422 with every problem found in the request.
+func writeValidationError(w http.ResponseWriter, r *http.Request, problems []utils.FieldError) {
+	msg := "request has 1 invalid field"
+	if len(problems) != 1 {
+		msg = "request has " + strconv.Itoa(len(problems)) + " invalid fields"
+	}
+	utils.WriteJSON(w, http.StatusUnprocessableEntity, ErrorBody{
+		Error:     "validation_failed",
+		Message:   msg,
+		RequestID: r.Header.Get("x-request-id"),
+		Details:   problems,
+	})
+}
+
+// writeUpstreamError maps a failed upstream call onto the error envelope.
+// Client errors the caller can act on keep their status; only gateway
+// failures become 502/504, and an open circuit becomes 503.
+func (h *Handler) writeUpstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	rid := r.Header.Get("x-request-id")
+
+	var open *upstream.CircuitOpenError
+	if errors.As(err, &open) {
+		setRetryAfter(w, open.RetryAfter)
+		utils.WriteJSON(w, http.StatusServiceUnavailable, ErrorBody{
+			Error:     "upstream_unavailable",
+			Message:   open.Error(),
+			RequestID: rid,
+			Retryable: true,
+		})
+		return
+	}
+
+	var ue *upstream.Error
+	if !errors.As(err, &ue) {
+		ue = &upstream.Error{Code: upstream.CodeUnreachable, Message: err.Error()}
+	}
+
+	status, code := upstreamErrorStatus(ue)
+	if ue.Code == upstream.CodeRateLimited && ue.RetryAfter > 0 {
+		setRetryAfter(w, ue.RetryAfter)
+	}
+
+	h.logr.Ctx(r.Context()).Warn("upstream.error", map[string]interface{}{
+		"path":              r.URL.Path,
+		"status":            status,
+		"upstreamStatus":    ue.Status,
+		"upstreamCode":      ue.Code,
+		"upstreamRequestId": ue.RequestID,
+		"message":           ue.Message,
+	})
+
+	utils.WriteJSON(w, status, ErrorBody{
+		Error:     code,
+		Message:   ue.Message,
+		RequestID: rid,
+		Retryable: ue.Retryable,
+		Upstream: &UpstreamErrorInfo{
+			Status:    ue.Status,
+			Code:      ue.Code,
+			RequestID: ue.RequestID,
+			Body:      ue.Body,
+		},
+	})
+}
+
+// upstreamErrorStatus returns the status and error code we answer with.
+func upstreamErrorStatus(e *upstream.Error) (int, string) {
+	switch e.Code {
+	case upstream.CodeBadRequest:
+		return http.StatusBadRequest, "invalid_request"
+	case upstream.CodeUnauthorized:
+		return http.StatusUnauthorized, "upstream_unauthorized"
+	case upstream.CodeForbidden:
+		return http.StatusForbidden, "forbidden"
+	case upstream.CodeNotFound:
+		return http.StatusNotFound, "not_found"
+	case upstream.CodeUnprocessable:
+		return http.StatusUnprocessableEntity, "unprocessable_entity"
+	case upstream.CodeRateLimited:
+		return http.StatusTooManyRequests, "rate_limited"
+	case upstream.CodeTimeout:
+		return http.StatusGatewayTimeout, "upstream_timeout"
+	case upstream.CodeCanceled:
+		// The caller went away; nginx's "client closed request".
+		return 499, "client_closed_request"
+	case upstream.CodeBadResponse:
+		return http.StatusBadGateway, "upstream_bad_response"
+	case upstream.CodeUnreachable:
+		return http.StatusBadGateway, "upstream_unreachable"
+	case upstream.CodeMissingToken:
+		return http.StatusUnauthorized, "caller_token_required"
+	}
+	return http.StatusBadGateway, "upstream_error"
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("retry-after", strconv.Itoa(secs))
+}
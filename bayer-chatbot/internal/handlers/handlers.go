@@ -1,249 +1,433 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"bayer-chatbot-service/internal/auth"
 	"bayer-chatbot-service/internal/config"
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/jobs"
 	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/streams"
+	"bayer-chatbot-service/internal/tracing"
 	"bayer-chatbot-service/internal/upstream"
 	"bayer-chatbot-service/internal/utils"
 )
 
 type Options struct {
-	Config config.Config
-	Logger *logger.Logger
-	Client *upstream.Client
+	Config        config.Config
+	Logger        *logger.Logger
+	Client        *upstream.Client
+	Conversations conversations.Store
+	Jobs          *jobs.Manager
+	Metrics       *metrics.Registry
+	Tracer        *tracing.Tracer
 }
 
 type Handler struct {
-	cfg    config.Config
-	logr   *logger.Logger
-	client *upstream.Client
+	cfg           config.Config
+	logr          *logger.Logger
+	client        *upstream.Client
+	conversations conversations.Store
+	jobs          *jobs.Manager
+	streams       *streamMetrics
+	resumable     *streams.Registry
+	admins        map[string]bool
+	ready         *readinessProbe
+	tracer        *tracing.Tracer
+	sockets       *wsSessions
 }
 
 func New(opts Options) *Handler {
-	return &Handler{cfg: opts.Config, logr: opts.Logger, client: opts.Client}
+	return &Handler{
+		cfg:           opts.Config,
+		logr:          opts.Logger,
+		client:        opts.Client,
+		conversations: opts.Conversations,
+		jobs:          opts.Jobs,
+		streams:       newStreamMetrics(opts.Metrics),
+		resumable: streams.NewRegistry(streams.Options{
+			MaxEvents:  opts.Config.StreamReplayEvents,
+			Retention:  opts.Config.StreamRetention,
+			MaxStreams: opts.Config.StreamCapacity,
+			Abandon:    opts.Config.StreamRetention,
+		}),
+		admins:  adminSet(opts.Config.AdminKeys),
+		ready:   &readinessProbe{},
+		tracer:  opts.Tracer,
+		sockets: newWSSessions(),
+	}
+}
+
+// adminSet parses ADMIN_KEYS, a comma-separated list of API-key names.
+func adminSet(spec string) map[string]bool {
+	set := map[string]bool{}
+	for _, name := range strings.Split(spec, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+// HealthResponse is the body of GET /health.
+type HealthResponse struct {
+	OK       bool                                `json:"ok"`
+	Circuits map[string]upstream.CircuitSnapshot `json:"circuits"`
 }
 
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
-	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{"ok": true})
+	utils.WriteJSON(w, http.StatusOK, HealthResponse{OK: true, Circuits: h.client.Circuits()})
 }
 
 func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	rid := r.Header.Get("x-request-id")
+	_, body, err := h.client.DoJSON(r.Context(), http.MethodGet, "/models", nil, nil, rid)
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
 		return
 	}
 
-	rid := r.Header.Get("x-request-id")
-	res, body, err := h.client.DoJSON(r.Context(), http.MethodGet, "/models", nil, nil, rid)
-	if err != nil {
-		msg := "upstream_error"
-		if res != nil {
-			msg = msg + ": " + res.Status
-		}
-		utils.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"error": "upstream_error", "message": msg, "requestId": rid})
+	list, ok := parseModelList(body)
+	if !ok {
+		h.writeUpstreamError(w, r, badUpstreamBody(body, "model list"))
 		return
 	}
+	utils.WriteJSON(w, http.StatusOK, list)
+}
 
-	w.Header().Set("content-type", "application/json; charset=utf-8")
-	w.WriteHeader(res.StatusCode)
-	_, _ = w.Write(body)
+// badUpstreamBody reports a successful upstream response we could not read.
+func badUpstreamBody(body []byte, what string) error {
+	return &upstream.Error{
+		Status:  http.StatusOK,
+		Code:    upstream.CodeBadResponse,
+		Message: "upstream returned an unrecognised " + what,
+		Body:    string(body[:min(len(body), 1024)]),
+	}
 }
 
-// AssistantUsers matches: GET /v1/assistants/:assistantId/users
-func (h *Handler) AssistantUsers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+func (h *Handler) Chat(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeChatRequest(w, r, false)
+	if !ok {
 		return
 	}
 
-	// Expected path: /v1/assistants/{assistantId}/users
-	// We keep parsing robust and return 404 for unexpected shapes.
-	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(parts) != 4 || parts[0] != "v1" || parts[1] != "assistants" || parts[3] != "users" {
-		w.WriteHeader(http.StatusNotFound)
+	convID, fresh, err := h.loadConversation(r.Context(), callerName(r), req)
+	if err != nil {
+		h.writeStoreError(w, r, err)
 		return
 	}
-	assistantID := parts[2]
-	if assistantID == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request", "message": "missing assistantId"})
+
+	if h.aggregates(req) {
+		h.chatAggregated(w, r, req, convID, fresh)
 		return
 	}
 
+	payload := req.upstreamBody(false)
+
 	rid := r.Header.Get("x-request-id")
-	path := "/assistants/" + url.PathEscape(assistantID) + "/users"
-	res, body, err := h.client.DoJSON(r.Context(), http.MethodGet, path, nil, nil, rid)
+	res, body, err := h.client.DoJSON(r.Context(), http.MethodPost, "/chat/agent", nil, payload, rid)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"error": "upstream_error", "message": "upstream_error", "requestId": rid})
+		h.writeUpstreamError(w, r, err)
 		return
 	}
 
+	if convID != "" {
+		var parsed interface{}
+		_ = json.Unmarshal(body, &parsed)
+		reply, _ := extractMessageText(parsed)
+		h.saveTurn(r, convID, fresh, reply)
+	}
+
 	w.Header().Set("content-type", "application/json; charset=utf-8")
 	w.WriteHeader(res.StatusCode)
 	_, _ = w.Write(body)
 }
 
-func (h *Handler) Chat(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		return
+// aggregates reports whether Chat should stream from the upstream.
+func (h *Handler) aggregates(req *ChatRequest) bool {
+	if req.Aggregate != nil {
+		return *req.Aggregate
 	}
+	return h.cfg.ChatAggregate
+}
 
-	input, err := readAsMap(r)
+// chatAggregated serves POST /v1/chat through the upstream stream: events
+// are folded into one ChatResult, so callers get a single JSON document from
+// assistants that only behave when streaming. An error event fails the
+// request, like a failed non-streaming call would.
+func (h *Handler) chatAggregated(w http.ResponseWriter, r *http.Request, req *ChatRequest, convID string, fresh []conversations.Message) {
+	query := url.Values{}
+	if req.BufferLength != nil {
+		query.Set("buffer_length", strconv.Itoa(*req.BufferLength))
+	}
+
+	rid := r.Header.Get("x-request-id")
+	res, err := h.client.DoSSE(r.Context(), "/chat/agent", query, req.upstreamBody(true), rid)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request", "message": err.Error()})
+		h.writeUpstreamError(w, r, err)
 		return
 	}
-
-	if err := validateChatInput(input); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request", "message": err.Error()})
+	body := utils.WatchStream(r.Context(), res.Body, utils.StreamTimeouts{MaxIdle: h.cfg.UpstreamIdleTimeout}, nil)
+	defer body.Close()
+
+	agg := &sse.Aggregate{}
+	err = sse.Relay(body, func(ev sse.Event) error {
+		agg.Add(ev)
+		return nil
+	})
+	if r.Context().Err() != nil {
 		return
 	}
-
-	upstreamBody := buildUpstreamChatBody(input, false)
-	payload, _ := json.Marshal(upstreamBody)
-
-	rid := r.Header.Get("x-request-id")
-	res, body, err := h.client.DoJSON(r.Context(), http.MethodPost, "/chat/agent", nil, payload, rid)
-	if err != nil {
-		msg := "upstream_error"
-		if res != nil {
-			msg = msg + ": " + res.Status
+	if agg.Error != nil {
+		status, code := http.StatusBadGateway, "upstream_error"
+		if agg.Error.Code == "upstream_idle_timeout" {
+			status, code = http.StatusGatewayTimeout, "upstream_timeout"
 		}
-		utils.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"error": "upstream_error", "message": msg, "requestId": rid})
+		h.logr.Ctx(r.Context()).Warn("upstream.stream_error", map[string]interface{}{
+			"path":         r.URL.Path,
+			"status":       status,
+			"upstreamCode": agg.Error.Code,
+			"message":      agg.Error.Message,
+		})
+		utils.WriteJSON(w, status, ErrorBody{
+			Error:     code,
+			Message:   agg.Error.Message,
+			RequestID: rid,
+			Retryable: status == http.StatusGatewayTimeout || agg.Error.Code == "stream_interrupted",
+			Upstream:  &UpstreamErrorInfo{Status: res.StatusCode, Code: agg.Error.Code},
+		})
 		return
 	}
 
-	w.Header().Set("content-type", "application/json; charset=utf-8")
-	w.WriteHeader(res.StatusCode)
-	_, _ = w.Write(body)
+	if err == nil {
+		h.saveTurn(r, convID, fresh, agg.Content)
+	}
+	utils.WriteJSON(w, http.StatusOK, chatResultFrom(agg))
 }
 
 func (h *Handler) ChatStream(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+	started := time.Now()
+	req, ok := h.decodeChatRequest(w, r, true)
+	if !ok {
 		return
 	}
 
-	input, err := readAsMap(r)
+	convID, fresh, err := h.loadConversation(r.Context(), callerName(r), req)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request", "message": err.Error()})
+		h.writeStoreError(w, r, err)
 		return
 	}
 
-	if err := validateChatInput(input); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, map[string]interface{}{"error": "invalid_request", "message": err.Error()})
-		return
-	}
+	payload := req.upstreamBody(true)
 
-	bufferLen := ""
-	if v, ok := input["buffer_length"]; ok {
-		// JSON numbers decode as float64
-		if f, ok := v.(float64); ok {
-			if f > 0 {
-				bufferLen = strings.TrimRight(strings.TrimRight(formatFloat(f), "0"), ".")
-			}
-		}
+	query := url.Values{}
+	if req.BufferLength != nil {
+		query.Set("buffer_length", strconv.Itoa(*req.BufferLength))
 	}
 
-	upstreamBody := buildUpstreamChatBody(input, true)
-	payload, _ := json.Marshal(upstreamBody)
-
-	query := url.Values{}
-	if bufferLen != "" {
-		query.Set("buffer_length", bufferLen)
+	// The generation outlives this request so a dropped caller can resume
+	// it at /v1/chat/stream/{streamId}; ?raw=1 streams stay tied to it.
+	raw := r.URL.Query().Get("raw") == "1"
+	parent := r.Context()
+	if !raw {
+		parent = context.WithoutCancel(parent)
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+	var stream *streams.Stream
+	if !raw {
+		if stream, err = h.resumable.Create(callerName(r), cancel); err != nil {
+			cancel(nil)
+			w.Header().Set("retry-after", "1")
+			writeError(w, r, http.StatusServiceUnavailable, "too_many_streams", "too many streams are running")
+			return
+		}
 	}
 
 	rid := r.Header.Get("x-request-id")
-	res, err := h.client.DoSSE(r.Context(), "/chat/agent", query, payload, rid)
+	res, err := h.client.DoSSE(ctx, "/chat/agent", query, payload, rid)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadGateway, map[string]interface{}{"error": "upstream_error", "message": err.Error(), "requestId": rid})
+		cancel(nil)
+		if stream != nil {
+			h.resumable.Remove(stream.ID)
+		}
+		h.writeUpstreamError(w, r, err)
 		return
 	}
-	defer res.Body.Close()
 
-	w.Header().Set("content-type", "text/event-stream")
-	w.Header().Set("cache-control", "no-cache, no-transform")
-	w.Header().Set("connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
+	// ?raw=1 relays upstream bytes untouched for debugging, so no heartbeat
+	// comments are mixed in; only the idle limit applies.
+	if raw {
+		defer cancel(nil)
+		body := utils.WatchStream(r.Context(), res.Body, utils.StreamTimeouts{MaxIdle: h.cfg.UpstreamIdleTimeout}, nil)
+		defer body.Close()
+		meter := h.startStream(r, "chatStream", w, started)
+		defer meter.finish()
+		w = meter
+
+		utils.SetSSEHeaders(w)
+		w.WriteHeader(http.StatusOK)
+
+		var src io.Reader = body
+		var buf bytes.Buffer
+		if convID != "" {
+			src = io.TeeReader(body, &buf)
+		}
+		err := utils.CopyAndFlush(w, src)
+		var idle *utils.IdleError
+		if errors.As(err, &idle) {
+			_ = utils.WriteSSE(w, sse.Event{Type: sse.EventError, Payload: sse.Interrupted(err)}.SSE())
+		}
+		if err == nil && convID != "" {
+			reply, _ := sse.CollectText(&buf)
+			h.saveTurn(r, convID, fresh, reply)
+		}
+		return
+	}
 
-	_ = utils.CopyAndFlush(w, res.Body)
+	// The caller's stream slots stay taken until the generation ends, not
+	// just while this request follows it.
+	release := holdLimits(r)
+	go func() {
+		defer release()
+		defer cancel(nil)
+		h.pumpStream(ctx, r, stream, res.Body, convID, fresh)
+	}()
+
+	meter := h.startStream(r, "chatStream", w, started)
+	defer meter.finish()
+	w = meter
+
+	w.Header().Set("x-stream-id", stream.ID)
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	h.followStream(w, r, stream, 0)
 }
 
-func readAsMap(r *http.Request) (map[string]interface{}, error) {
-	var input map[string]interface{}
-	if err := utils.ReadJSON(r, &input, 2<<20); err != nil {
-		return nil, err
+// ResumeChatStream reattaches a caller to a generation started by
+// ChatStream. Events after Last-Event-ID (header, or lastEventId query for
+// clients that cannot set it) are replayed, then the stream continues live.
+func (h *Handler) ResumeChatStream(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	last := r.Header.Get("last-event-id")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
 	}
-	if input == nil {
-		input = map[string]interface{}{}
+	after, ok := streams.ParseEventID(last)
+	if !ok {
+		writeValidationError(w, r, []utils.FieldError{{Field: "Last-Event-ID", Problem: "must be a non-negative integer"}})
+		return
 	}
-	return input, nil
-}
 
-func validateChatInput(input map[string]interface{}) error {
-	if input == nil {
-		return errString("missing body")
+	stream, err := h.resumable.Get(r.PathValue("streamId"), callerName(r))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "stream_not_found", "stream not found or no longer resumable")
+		return
 	}
+	if err := stream.Check(after); err != nil {
+		writeError(w, r, http.StatusGone, "replay_expired", err.Error())
+		return
+	}
+
+	meter := h.startStream(r, "resumeChatStream", w, started)
+	defer meter.finish()
+	w = meter
+
+	w.Header().Set("x-stream-id", stream.ID)
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	h.followStream(w, r, stream, after)
+}
 
-	// messages must exist and have at least one element
-	msgs, ok := input["messages"].([]interface{})
-	if !ok || len(msgs) < 1 {
-		return errString("messages must be a non-empty array")
+var errStreamCanceled = errors.New("canceled by the caller")
+
+// CancelChatStream serves DELETE /v1/chat/stream/{streamId}: it stops the
+// generation, whose followers then get an error with code canceled and done.
+// Finished streams are left as they are.
+func (h *Handler) CancelChatStream(w http.ResponseWriter, r *http.Request) {
+	stream, err := h.resumable.Get(r.PathValue("streamId"), callerName(r))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "stream_not_found", "stream not found or no longer resumable")
+		return
 	}
+	stream.Cancel(errStreamCanceled)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	for _, raw := range msgs {
-		m, ok := raw.(map[string]interface{})
-		if !ok {
-			return errString("messages must be objects")
-		}
-		role, _ := m["role"].(string)
-		content, _ := m["content"].(string)
-		if role == "" || content == "" {
-			return errString("each message requires role and content")
+// pumpStream normalizes the upstream body into s until the generation ends,
+// is canceled or nobody followed it for STREAM_RETENTION, and saves
+// completed turns.
+func (h *Handler) pumpStream(ctx context.Context, r *http.Request, s *streams.Stream, body io.ReadCloser, convID string, fresh []conversations.Message) {
+	defer s.Close()
+	// No heartbeat here: followers ping their own connections.
+	body = utils.WatchStream(ctx, body, utils.StreamTimeouts{MaxIdle: h.cfg.UpstreamIdleTimeout}, nil)
+	defer body.Close()
+
+	var reply strings.Builder
+	failed := false
+	err := sse.Relay(body, func(ev sse.Event) error {
+		switch p := ev.Payload.(type) {
+		case sse.DeltaPayload:
+			reply.WriteString(p.Delta)
+		case sse.ErrorPayload:
+			failed = true
+			if ctx.Err() != nil {
+				// Stopped on purpose, not by the upstream.
+				ev.Payload = sse.ErrorPayload{Code: "canceled", Message: context.Cause(ctx).Error()}
+			}
 		}
+		s.Append(ev.SSE())
+		return nil
+	})
+	// Only completed generations are persisted.
+	if err == nil && !failed {
+		h.saveTurn(r, convID, fresh, reply.String())
 	}
+}
 
-	_, hasAssistant := input["assistant_id"].(string)
-	_, hasModel := input["model"].(string)
-	if !hasAssistant && !hasModel {
-		return errString("Provide either assistant_id or model")
+// followStream writes events of s after the id after until the stream ends
+// or the caller goes away, with ": ping" comments while the generation is
+// quiet. A caller too slow for the replay buffer gets an
+// error and done event, so done stays the last event it sees.
+func (h *Handler) followStream(w http.ResponseWriter, r *http.Request, s *streams.Stream, after int64) {
+	hb := streams.Heartbeat{Every: h.cfg.SSEHeartbeatInterval, Ping: func() error { return utils.WritePing(w) }}
+	err := s.Follow(r.Context(), after, hb, func(ev utils.SSEEvent) error {
+		return utils.WriteSSE(w, ev)
+	})
+	if errors.Is(err, streams.ErrExpired) {
+		for _, ev := range []sse.Event{
+			{Type: sse.EventError, Payload: sse.ErrorPayload{Code: "replay_expired", Message: err.Error()}},
+			{Type: sse.EventDone, Payload: sse.DonePayload{FinishReason: "error"}},
+		} {
+			_ = utils.WriteSSE(w, ev.SSE())
+		}
 	}
-
-	return nil
 }
 
-func buildUpstreamChatBody(input map[string]interface{}, stream bool) map[string]interface{} {
-	out := map[string]interface{}{}
-	for k, v := range input {
-		out[k] = v
-	}
-	out["stream"] = stream
+// callerName identifies the caller a stream belongs to; empty when API keys
+// are not configured.
+func callerName(r *http.Request) string {
+	id, _ := auth.FromContext(r.Context())
+	return id.Name
+}
 
-	// Convert messages to include metadata: {}
-	msgs := input["messages"].([]interface{})
-	converted := make([]interface{}, 0, len(msgs))
-	for _, raw := range msgs {
-		m := raw.(map[string]interface{})
-		converted = append(converted, map[string]interface{}{
-			"role":     m["role"],
-			"content":  m["content"],
-			"metadata": map[string]interface{}{},
-		})
-	}
-	out["messages"] = converted
-	return out
+// streamTimeouts applies the configured heartbeat and upstream idle limit to
+// streams relayed straight to the caller.
+func (h *Handler) streamTimeouts() utils.StreamTimeouts {
+	return utils.StreamTimeouts{Heartbeat: h.cfg.SSEHeartbeatInterval, MaxIdle: h.cfg.UpstreamIdleTimeout}
 }
 
 type errString string
 
 func (e errString) Error() string { return string(e) }
-
-func formatFloat(f float64) string {
-	b, _ := json.Marshal(f)
-	return strings.Trim(string(b), "\"")
-}
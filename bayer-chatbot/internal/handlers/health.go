@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// LivenessResponse is the body of GET /livez.
+type LivenessResponse struct {
+	OK bool `json:"ok"`
+}
+
+// ReadinessResponse is the body of GET /readyz.
+type ReadinessResponse struct {
+	OK     bool            `json:"ok"`
+	Checks ReadinessChecks `json:"checks"`
+	Build  BuildInfo       `json:"build"`
+}
+
+type ReadinessChecks struct {
+	Config   ConfigCheck  `json:"config"`
+	Upstream ProbeResult  `json:"upstream"`
+	Circuits CircuitCheck `json:"circuits"`
+}
+
+type ConfigCheck struct {
+	OK        bool     `json:"ok"`
+	TokenMode string   `json:"tokenMode"`
+	TokenSet  bool     `json:"tokenSet"`
+	Problems  []string `json:"problems"`
+}
+
+type CircuitCheck struct {
+	OK       bool                                `json:"ok"`
+	Open     []string                            `json:"open"`
+	Circuits map[string]upstream.CircuitSnapshot `json:"circuits"`
+}
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	GoVersion  string `json:"goVersion"`
+	Path       string `json:"path,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Revision   string `json:"revision,omitempty"`
+	CommitTime string `json:"commitTime,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+}
+
+// Livez reports that the process is up and serving. It never touches the
+// upstream so a slow dependency cannot get the instance restarted.
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, LivenessResponse{OK: true})
+}
+
+// Readyz reports whether the instance can serve traffic: configuration is
+// sane, the upstream answers GET /models with the service token, and no
+// circuit is open. Any failing check turns the response into a 503.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	circuits := h.client.Circuits()
+	open := []string{}
+	for endpoint, c := range circuits {
+		if c.State == upstream.CircuitOpen {
+			open = append(open, endpoint)
+		}
+	}
+
+	checks := ReadinessChecks{
+		Config:   h.configCheck(),
+		Upstream: h.ready.get(h.client, h.cfg.ReadyzProbeInterval, h.cfg.ReadyzProbeTimeout),
+		Circuits: CircuitCheck{OK: len(open) == 0, Open: open, Circuits: circuits},
+	}
+	ok := checks.Config.OK && checks.Upstream.OK && checks.Circuits.OK
+
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	utils.WriteJSON(w, status, ReadinessResponse{OK: ok, Checks: checks, Build: buildInfo()})
+}
+
+func (h *Handler) configCheck() ConfigCheck {
+	problems := []string{}
+	passthrough := h.cfg.BayerChatTokenMode == upstream.TokenModePassthrough
+	if h.cfg.BayerChatAccessToken == "" && !passthrough {
+		problems = append(problems, "BAYER_CHAT_ACCESS_TOKEN is not set")
+	}
+	if u, err := url.Parse(h.cfg.BayerChatBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "BAYER_CHAT_BASE_URL is not an absolute http(s) URL")
+	}
+	return ConfigCheck{
+		OK:        len(problems) == 0,
+		TokenMode: h.cfg.BayerChatTokenMode,
+		TokenSet:  h.cfg.BayerChatAccessToken != "",
+		Problems:  problems,
+	}
+}
+
+// ProbeResult is the outcome of the last upstream readiness probe.
+type ProbeResult struct {
+	OK        bool      `json:"ok"`
+	Skipped   bool      `json:"skipped,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Status    int       `json:"status,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+	Cached    bool      `json:"cached"`
+}
+
+// readinessProbe caches the upstream probe so /readyz polling from many
+// orchestrator replicas turns into at most one upstream call per interval.
+// Concurrent callers wait for the probe in flight rather than starting
+// their own.
+type readinessProbe struct {
+	mu   sync.Mutex
+	last *ProbeResult
+}
+
+func (p *readinessProbe) get(client *upstream.Client, interval, timeout time.Duration) ProbeResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last != nil && time.Since(p.last.CheckedAt) < interval {
+		res := *p.last
+		res.Cached = true
+		return res
+	}
+
+	res := ProbeResult{CheckedAt: time.Now()}
+	// Detached from the request so a caller hanging up does not poison
+	// the cached result.
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := client.Ping(ctx)
+	res.LatencyMs = time.Since(res.CheckedAt).Milliseconds()
+
+	var ue *upstream.Error
+	var coe *upstream.CircuitOpenError
+	switch {
+	case err == nil:
+		res.OK = true
+	case errors.Is(err, upstream.ErrNoServiceToken):
+		// Passthrough mode has no token of its own to probe with; every
+		// call uses the caller's token, so there is nothing to verify here.
+		res.OK = true
+		res.Skipped = true
+		res.Error = err.Error()
+	case errors.As(err, &ue):
+		res.Error = ue.Message
+		res.Code = ue.Code
+		res.Status = ue.Status
+	case errors.As(err, &coe):
+		res.Error = err.Error()
+		res.Code = "circuit_open"
+	default:
+		res.Error = err.Error()
+	}
+
+	p.last = &res
+	return res
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path = bi.Main.Path
+	info.Version = bi.Main.Version
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"bayer-chatbot-service/internal/auth"
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/jobs"
+	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/streams"
+	"bayer-chatbot-service/internal/tracing"
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// jobsReady answers 501 when no job manager is configured.
+func (h *Handler) jobsReady(w http.ResponseWriter, r *http.Request) bool {
+	if h.jobs == nil {
+		writeError(w, r, http.StatusNotImplemented, "not_implemented", "background jobs are not configured")
+		return false
+	}
+	return true
+}
+
+// CreateJob serves POST /v1/jobs. The body is a chat request; the generation
+// runs on the worker pool and outlives the request.
+func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	if !h.jobsReady(w, r) {
+		return
+	}
+	req, ok := h.decodeChatRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	convID, fresh, err := h.loadConversation(r.Context(), callerName(r), req)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	payload := req.upstreamBody(true)
+	query := url.Values{}
+	if req.BufferLength != nil {
+		query.Set("buffer_length", strconv.Itoa(*req.BufferLength))
+	}
+	rid := r.Header.Get("x-request-id")
+	owner := callerName(r)
+
+	job, err := h.jobs.Submit(jobContext(r), owner, func(ctx context.Context, s *streams.Stream) *sse.Aggregate {
+		agg := h.runChatJob(ctx, s, query, payload, rid)
+		if agg.Error == nil && ctx.Err() == nil {
+			h.saveJobTurn(ctx, convID, owner, fresh, agg.Content)
+		}
+		return agg
+	})
+	switch {
+	case errors.Is(err, jobs.ErrQueueFull), errors.Is(err, jobs.ErrClosed):
+		setRetryAfter(w, 5*time.Second)
+		utils.WriteJSON(w, http.StatusServiceUnavailable, ErrorBody{
+			Error:     "jobs_unavailable",
+			Message:   err.Error(),
+			RequestID: rid,
+			Retryable: true,
+		})
+		return
+	case err != nil:
+		h.writeJobError(w, r, err)
+		return
+	}
+
+	w.Header().Set("location", "/v1/jobs/"+job.ID)
+	utils.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// jobContext carries what a job needs from the submitting request: the
+// logger, the trace, the caller identity and upstream token. Other request
+// values, such as the x-upstream-attempts reporter that writes to the
+// request's response headers, must not be used once the request returned.
+func jobContext(r *http.Request) context.Context {
+	src := r.Context()
+	ctx := context.Background()
+	if l := logger.FromContext(src); l != nil {
+		ctx = logger.WithContext(ctx, l)
+	}
+	if sc := tracing.SpanContextFromContext(src); sc.IsValid() {
+		ctx = tracing.ContextWithRemote(ctx, sc)
+	}
+	if id, ok := auth.FromContext(src); ok {
+		ctx = auth.WithIdentity(ctx, id)
+	}
+	return upstream.WithCallerToken(ctx, upstream.CallerToken(src))
+}
+
+// runChatJob streams one generation into s and returns what it produced.
+// Cancellation stops the relay and is reported as an error event.
+func (h *Handler) runChatJob(ctx context.Context, s *streams.Stream, query url.Values, payload []byte, rid string) *sse.Aggregate {
+	agg := &sse.Aggregate{}
+	emit := func(ev sse.Event) {
+		agg.Add(ev)
+		s.Append(ev.SSE())
+	}
+	fail := func(code, message string) *sse.Aggregate {
+		emit(sse.Event{Type: sse.EventError, Payload: sse.ErrorPayload{Code: code, Message: message}})
+		emit(sse.Event{Type: sse.EventDone, Payload: sse.DonePayload{FinishReason: "error"}})
+		return agg
+	}
+
+	res, err := h.client.DoSSE(ctx, "/chat/agent", query, payload, rid)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fail("canceled", context.Cause(ctx).Error())
+		}
+		var ue *upstream.Error
+		if !errors.As(err, &ue) {
+			ue = &upstream.Error{Code: upstream.CodeUnreachable, Message: err.Error()}
+		}
+		_, code := upstreamErrorStatus(ue)
+		return fail(code, ue.Message)
+	}
+	// Events are buffered rather than written to a client, so only the
+	// idle limit applies.
+	body := utils.WatchStream(ctx, res.Body, utils.StreamTimeouts{MaxIdle: h.cfg.UpstreamIdleTimeout}, nil)
+	defer body.Close()
+
+	// Read errors reach the stream as an error event; only cancellation
+	// needs handling here.
+	_ = sse.Relay(body, func(ev sse.Event) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		emit(ev)
+		return nil
+	})
+	if ctx.Err() != nil && !agg.Done() {
+		return fail("canceled", context.Cause(ctx).Error())
+	}
+	return agg
+}
+
+// saveJobTurn is saveTurn for jobs, which have no request to log against.
+func (h *Handler) saveJobTurn(ctx context.Context, id, owner string, fresh []conversations.Message, reply string) {
+	if id == "" {
+		return
+	}
+	msgs := append(fresh, conversations.Message{Role: "assistant", Content: reply})
+	if _, err := h.conversations.Append(context.Background(), id, owner, msgs...); err != nil {
+		h.logr.Ctx(ctx).Error("conversations.save_error", map[string]interface{}{
+			"conversationId": id,
+			"error":          err.Error(),
+		})
+	}
+}
+
+// GetJob serves GET /v1/jobs/{jobId}.
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	if !h.jobsReady(w, r) {
+		return
+	}
+	job, err := h.jobs.Get(r.Context(), r.PathValue("jobId"), callerName(r))
+	if err != nil {
+		h.writeJobError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, job)
+}
+
+// CancelJob serves DELETE /v1/jobs/{jobId}. It answers with the job once it
+// has stopped; finished jobs are returned unchanged.
+func (h *Handler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	if !h.jobsReady(w, r) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	job, err := h.jobs.Cancel(ctx, r.PathValue("jobId"), callerName(r))
+	if err != nil {
+		h.writeJobError(w, r, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, job)
+}
+
+// JobEvents serves GET /v1/jobs/{jobId}/events, the job's normalized stream
+// with Last-Event-ID resume. Once the buffered stream has expired a finished
+// job's stored result is replayed as one event per part instead.
+func (h *Handler) JobEvents(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	if !h.jobsReady(w, r) {
+		return
+	}
+	last := r.Header.Get("last-event-id")
+	if last == "" {
+		last = r.URL.Query().Get("lastEventId")
+	}
+	after, ok := streams.ParseEventID(last)
+	if !ok {
+		writeValidationError(w, r, []utils.FieldError{{Field: "Last-Event-ID", Problem: "must be a non-negative integer"}})
+		return
+	}
+
+	id, owner := r.PathValue("jobId"), callerName(r)
+	stream, err := h.jobs.Events(id, owner)
+	if err != nil {
+		job, err := h.jobs.Get(r.Context(), id, owner)
+		if err != nil {
+			h.writeJobError(w, r, err)
+			return
+		}
+		h.replayJob(w, r, job, started)
+		return
+	}
+	if err := stream.Check(after); err != nil {
+		writeError(w, r, http.StatusGone, "replay_expired", err.Error())
+		return
+	}
+
+	meter := h.startStream(r, "jobEvents", w, started)
+	defer meter.finish()
+	w = meter
+
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	h.followStream(w, r, stream, after)
+}
+
+// replayJob writes a finished job's stored result as an event stream.
+func (h *Handler) replayJob(w http.ResponseWriter, r *http.Request, job jobs.Job, started time.Time) {
+	agg := job.Result
+	if agg == nil {
+		agg = &sse.Aggregate{FinishReason: "error"}
+	}
+	if agg.Error == nil && job.Error != nil {
+		copied := *agg
+		copied.Error = job.Error
+		agg = &copied
+	}
+
+	meter := h.startStream(r, "jobEvents", w, started)
+	defer meter.finish()
+	w = meter
+
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+	for _, ev := range agg.Events() {
+		if err := utils.WriteSSE(w, ev.SSE()); err != nil {
+			return
+		}
+	}
+}
+
+func (h *Handler) writeJobError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, jobs.ErrNotFound) || errors.Is(err, streams.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, "not_found", jobs.ErrNotFound.Error())
+		return
+	}
+	h.logr.Ctx(r.Context()).Error("jobs.error", map[string]interface{}{
+		"error": err.Error(),
+	})
+	writeError(w, r, http.StatusInternalServerError, "internal_error", "job store failed")
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bayer-chatbot-service/internal/auth"
+	"bayer-chatbot-service/internal/jobs"
+	"bayer-chatbot-service/internal/upstream"
+)
+
+// TestCreateJobOutlivesRequest runs a job after its request returned. The
+// request carries an attempts reporter the way the server's middleware
+// sets it; the job must not write to the finished response through it.
+// Run with -race.
+func TestCreateJobOutlivesRequest(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("x-baychatgpt-accesstoken"); got != "alice-token" {
+			http.Error(w, "token "+got, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("content-type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"delta\":\"hi\"}\n\ndata: [DONE]\n\n")
+	}))
+	defer up.Close()
+
+	manager := jobs.NewManager(jobs.Options{Workers: 2})
+	defer manager.Shutdown(context.Background())
+	h := New(Options{
+		Client: upstream.NewClient(upstream.Options{BaseURL: up.URL, TokenMode: upstream.TokenModePassthrough}),
+		Jobs:   manager,
+	})
+
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+		r := httptest.NewRequest(http.MethodPost, "/v1/jobs", strings.NewReader(body))
+		ctx := auth.WithIdentity(r.Context(), auth.Identity{Name: "alice"})
+		ctx = upstream.WithCallerToken(ctx, "alice-token")
+		ctx = upstream.WithAttemptsReporter(ctx, func(n int) {
+			w.Header().Set(upstream.AttemptsHeader, fmt.Sprint(n))
+		})
+		h.CreateJob(w, r.WithContext(ctx))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		// What the server does with a finished response.
+		header := w.Header().Clone()
+
+		var job jobs.Job
+		if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for !job.Final() {
+			if time.Now().After(deadline) {
+				t.Fatalf("job still %s", job.Status)
+			}
+			time.Sleep(5 * time.Millisecond)
+			var err error
+			if job, err = manager.Get(context.Background(), job.ID, "alice"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if job.Status != jobs.StatusSucceeded || job.Result == nil || job.Result.Content != "hi" {
+			t.Fatalf("job %s: %+v %+v", job.Status, job.Result, job.Error)
+		}
+		if got := w.Header().Get(upstream.AttemptsHeader); got != header.Get(upstream.AttemptsHeader) {
+			t.Errorf("the job set %s to %q after the response was sent", upstream.AttemptsHeader, got)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Limits is the rate limiter's view of one request, attached to the request
+// context by the server's rate-limit middleware.
+type Limits interface {
+	// Hold keeps the stream slots taken for the request after the handler
+	// returns, until the returned func is called.
+	Hold() (release func())
+	// Acquire applies the caller and model rate limits and stream caps to
+	// one more generation started by the request, such as a WebSocket
+	// chat message. The returned func frees its stream slots.
+	Acquire(model, assistantID string) (release func(), err error)
+}
+
+// LimitError is returned by Limits.Acquire when a limit refuses a
+// generation.
+type LimitError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return "rate limit exceeded (" + e.Scope + ")"
+}
+
+type limitsKey struct{}
+
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+// holdLimits is Hold for r; without a rate limiter it holds nothing.
+func holdLimits(r *http.Request) func() {
+	if l, ok := r.Context().Value(limitsKey{}).(Limits); ok {
+		return l.Hold()
+	}
+	return func() {}
+}
+
+// acquireLimits is Acquire for r; without a rate limiter everything is
+// allowed.
+func acquireLimits(r *http.Request, model, assistantID string) (func(), error) {
+	if l, ok := r.Context().Value(limitsKey{}).(Limits); ok {
+		return l.Acquire(model, assistantID)
+	}
+	return func() {}, nil
+}
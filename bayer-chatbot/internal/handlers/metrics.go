@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/tracing"
+)
+
+// streamBuckets cover generations lasting from under a second to minutes.
+var streamBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type streamMetrics struct {
+	active   *metrics.GaugeVec
+	ttfb     *metrics.HistogramVec
+	duration *metrics.HistogramVec
+	bytes    *metrics.CounterVec
+}
+
+func newStreamMetrics(reg *metrics.Registry) *streamMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &streamMetrics{
+		active:   reg.Gauge("sse_active_streams", "SSE streams currently open to callers.", "route"),
+		ttfb:     reg.Histogram("sse_time_to_first_byte_seconds", "Time from request start to the first streamed byte.", nil, "route"),
+		duration: reg.Histogram("sse_stream_duration_seconds", "Total duration of SSE streams.", streamBuckets, "route"),
+		bytes:    reg.Counter("sse_bytes_relayed_total", "Bytes streamed to callers.", "route"),
+	}
+}
+
+// start wraps w so the stream's first byte, size and duration are recorded.
+// started is when the handler began, so TTFB includes the upstream wait.
+func (m *streamMetrics) start(route string, w http.ResponseWriter, started time.Time) *streamMeter {
+	if m != nil {
+		m.active.Inc(route)
+	}
+	return &streamMeter{ResponseWriter: w, m: m, route: route, started: started}
+}
+
+// startStream begins metrics and a span covering the lifetime of a stream to
+// the caller. Callers must call finish on the result.
+func (h *Handler) startStream(r *http.Request, route string, w http.ResponseWriter, started time.Time) *streamMeter {
+	_, span := h.tracer.Start(r.Context(), "stream "+route, tracing.KindInternal)
+	meter := h.streams.start(route, w, started)
+	meter.span = span
+	return meter
+}
+
+// streamMeter is an http.ResponseWriter that feeds streamMetrics and the
+// stream span.
+type streamMeter struct {
+	http.ResponseWriter
+	m       *streamMetrics
+	span    *tracing.Span
+	route   string
+	started time.Time
+	first   bool
+	bytes   int64
+}
+
+func (s *streamMeter) Write(p []byte) (int, error) {
+	if !s.first && len(p) > 0 {
+		s.first = true
+		if s.m != nil {
+			s.m.ttfb.Observe(time.Since(s.started).Seconds(), s.route)
+		}
+	}
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *streamMeter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *streamMeter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *streamMeter) finish() {
+	s.span.SetAttribute("stream.bytes", s.bytes)
+	s.span.End()
+	if s.m == nil {
+		return
+	}
+	s.m.active.Dec(s.route)
+	s.m.duration.Observe(time.Since(s.started).Seconds(), s.route)
+	s.m.bytes.Add(float64(s.bytes), s.route)
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// ChatCompletionRequest is the subset of the OpenAI Chat Completions request we
+// translate. assistant_id, tool_keys and hidden are accepted as extensions.
+// Other OpenAI parameters are ignored rather than rejected, since SDKs send
+// them routinely.
+type ChatCompletionRequest struct {
+	Model       string                  `json:"model,omitempty"`
+	Messages    []ChatCompletionMessage `json:"messages"`
+	Temperature *float64                `json:"temperature,omitempty"`
+	MaxTokens   *int                    `json:"max_tokens,omitempty"`
+	Stream      bool                    `json:"stream,omitempty"`
+	Stop        json.RawMessage         `json:"stop,omitempty"`
+	N           *int                    `json:"n,omitempty"`
+
+	AssistantID string   `json:"assistant_id,omitempty"`
+	ToolKeys    []string `json:"tool_keys,omitempty"`
+	Hidden      *bool    `json:"hidden,omitempty"`
+}
+
+type ChatCompletionMessage struct {
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	ToolCalls json.RawMessage `json:"tool_calls,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int                  `json:"index"`
+	Message      *ChatCompletionReply `json:"message,omitempty"`
+	Delta        *ChatCompletionReply `json:"delta,omitempty"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type ChatCompletionReply struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	Created int64                  `json:"created"`
+	Model   string                 `json:"model"`
+	Choices []ChatCompletionChoice `json:"choices"`
+	Usage   interface{}            `json:"usage,omitempty"`
+}
+
+// ChatCompletions matches: POST /v1/chat/completions (OpenAI-compatible).
+func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	body, err := utils.ReadBody(r, chatBodyLimit)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	var req ChatCompletionRequest
+	problems, err := utils.DecodeTyped(body, &req)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	chat, mapped := openAIToChatRequest(req)
+	problems = mergeProblems(problems, mapped)
+	if len(problems) > 0 {
+		writeValidationError(w, r, problems)
+		return
+	}
+
+	rid := r.Header.Get("x-request-id")
+	model := req.Model
+	if model == "" {
+		model = req.AssistantID
+	}
+
+	if req.Stream {
+		h.chatCompletionsStream(w, r, chat, model, rid, started)
+		return
+	}
+
+	_, body, err = h.client.DoJSON(r.Context(), http.MethodPost, "/chat/agent", nil, chat.upstreamBody(false), rid)
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+
+	var parsed interface{}
+	_ = json.Unmarshal(body, &parsed)
+	content, finish := extractMessageText(parsed)
+	finish = openAIFinishReason(finish)
+
+	utils.WriteJSON(w, http.StatusOK, ChatCompletionResponse{
+		ID:      "chatcmpl-" + rid,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChatCompletionChoice{{
+			Index:        0,
+			Message:      &ChatCompletionReply{Role: "assistant", Content: content},
+			FinishReason: &finish,
+		}},
+		Usage: extractUsage(parsed),
+	})
+}
+
+func (h *Handler) chatCompletionsStream(w http.ResponseWriter, r *http.Request, chat *ChatRequest, model, rid string, started time.Time) {
+	res, err := h.client.DoSSE(r.Context(), "/chat/agent", url.Values{}, chat.upstreamBody(true), rid)
+	if err != nil {
+		h.writeUpstreamError(w, r, err)
+		return
+	}
+	meter := h.startStream(r, "chatCompletions", w, started)
+	defer meter.finish()
+	w = meter
+
+	body := utils.WatchStream(r.Context(), res.Body, h.streamTimeouts(), func() error { return utils.WritePing(w) })
+	defer body.Close()
+
+	utils.SetSSEHeaders(w)
+	w.WriteHeader(http.StatusOK)
+
+	id := "chatcmpl-" + rid
+	created := time.Now().Unix()
+	emit := func(delta *ChatCompletionReply, finish *string) error {
+		b, _ := json.Marshal(ChatCompletionResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []ChatCompletionChoice{{Index: 0, Delta: delta, FinishReason: finish}},
+		})
+		return utils.WriteSSE(w, utils.SSEEvent{Data: string(b)})
+	}
+
+	if err := emit(&ChatCompletionReply{Role: "assistant"}, nil); err != nil {
+		return
+	}
+
+	n := sse.NewNormalizer()
+	var tail []sse.Event
+	err = utils.ReadSSE(body, func(ev utils.SSEEvent) error {
+		for _, out := range n.Push(ev) {
+			switch p := out.Payload.(type) {
+			case sse.DeltaPayload:
+				if err := emit(&ChatCompletionReply{Content: p.Delta}, nil); err != nil {
+					return err
+				}
+			case sse.ErrorPayload, sse.DonePayload:
+				tail = append(tail, out)
+			}
+		}
+		if n.Done() {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		if r.Context().Err() != nil {
+			return
+		}
+		tail = append(tail, sse.Event{Type: sse.EventError, Payload: sse.Interrupted(err)})
+	}
+
+	tail = append(tail, n.Finish()...)
+	failed := false
+	writeErr := func(p sse.ErrorPayload) error {
+		failed = true
+		b, _ := json.Marshal(map[string]interface{}{"error": map[string]interface{}{"code": p.Code, "message": p.Message}})
+		return utils.WriteSSE(w, utils.SSEEvent{Data: string(b)})
+	}
+	for _, out := range tail {
+		switch p := out.Payload.(type) {
+		case sse.ErrorPayload:
+			if writeErr(p) != nil {
+				return
+			}
+		case sse.DonePayload:
+			// OpenAI clients reject unknown finish reasons, so an upstream
+			// "error" becomes an error object followed by a plain stop.
+			if p.FinishReason == "error" && !failed {
+				if writeErr(sse.ErrorPayload{Code: "upstream_error", Message: "the upstream ended the generation with an error"}) != nil {
+					return
+				}
+			}
+			finish := openAIFinishReason(p.FinishReason)
+			if emit(&ChatCompletionReply{}, &finish) != nil {
+				return
+			}
+		}
+	}
+	_ = utils.WriteSSE(w, utils.SSEEvent{Data: "[DONE]"})
+}
+
+// openAIToChatRequest maps an OpenAI request onto ChatRequest and validates
+// it. Problems are reported with the OpenAI field names, which
+// ChatRequest.validate shares, and the indexes of the original messages.
+//
+// The upstream knows only user, assistant and system turns: developer
+// messages are sent as system, while tool results and assistant turns that
+// only call tools are dropped, since tools run upstream.
+func openAIToChatRequest(req ChatCompletionRequest) (*ChatRequest, []utils.FieldError) {
+	var v violations
+	if req.N != nil && *req.N != 1 {
+		v.add("n", "only 1 is supported")
+	}
+
+	chat := &ChatRequest{
+		Model:       req.Model,
+		AssistantID: req.AssistantID,
+		Messages:    make([]ChatMessage, 0, len(req.Messages)),
+		ToolKeys:    req.ToolKeys,
+		Hidden:      req.Hidden,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+	}
+	var kept []int
+	for i, m := range req.Messages {
+		content, err := flattenOpenAIContent(m.Content)
+		if err != nil {
+			v.add("messages["+strconv.Itoa(i)+"].content", err.Error())
+		}
+		role := m.Role
+		switch {
+		case role == "developer":
+			role = "system"
+		case role == "tool" || role == "function":
+			continue
+		case role == "assistant" && content == "" && len(m.ToolCalls) > 0 && string(m.ToolCalls) != "null":
+			continue
+		}
+		chat.Messages = append(chat.Messages, ChatMessage{Role: role, Content: content})
+		kept = append(kept, i)
+	}
+
+	if len(req.Stop) > 0 && string(req.Stop) != "null" {
+		var one string
+		var many []string
+		if json.Unmarshal(req.Stop, &one) == nil {
+			chat.Stop = []string{one}
+		} else if json.Unmarshal(req.Stop, &many) == nil {
+			chat.Stop = many
+		} else {
+			v.add("stop", "must be a string or an array of strings")
+		}
+	}
+
+	return chat, mergeProblems(v, renumberMessages(chat.validate(false, false), kept))
+}
+
+// renumberMessages points problems on chat.Messages back at the request
+// message each one came from.
+func renumberMessages(problems []utils.FieldError, kept []int) []utils.FieldError {
+	for i, p := range problems {
+		rest := strings.TrimPrefix(p.Field, "messages[")
+		end := strings.IndexByte(rest, ']')
+		if rest == p.Field || end < 0 {
+			continue
+		}
+		if n, err := strconv.Atoi(rest[:end]); err == nil && n < len(kept) {
+			problems[i].Field = "messages[" + strconv.Itoa(kept[n]) + rest[end:]
+		}
+	}
+	return problems
+}
+
+// openAIFinishReason maps a finish reason onto the ones OpenAI defines.
+func openAIFinishReason(reason string) string {
+	switch reason {
+	case "stop", "length", "tool_calls", "content_filter", "function_call":
+		return reason
+	}
+	return "stop"
+}
+
+// flattenOpenAIContent accepts either a string or an array of content parts
+// and joins the text parts.
+func flattenOpenAIContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errString("must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, ""), nil
+}
+
+// extractMessageText pulls the assistant text out of a non-streaming upstream
+// response. It understands OpenAI-style choices as well as flat
+// {content}/{message:{content}}/{text} shapes.
+func extractMessageText(v interface{}) (string, string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", ""
+	}
+	if choices, ok := m["choices"].([]interface{}); ok && len(choices) > 0 {
+		if c, ok := choices[0].(map[string]interface{}); ok {
+			reason, _ := c["finish_reason"].(string)
+			if msg, ok := c["message"].(map[string]interface{}); ok {
+				if s, ok := msg["content"].(string); ok {
+					return s, reason
+				}
+			}
+			if s, ok := c["text"].(string); ok {
+				return s, reason
+			}
+		}
+	}
+	if msg, ok := m["message"].(map[string]interface{}); ok {
+		if s, ok := msg["content"].(string); ok {
+			return s, ""
+		}
+	}
+	for _, k := range []string{"content", "text", "answer"} {
+		if s, ok := m[k].(string); ok {
+			return s, ""
+		}
+	}
+	return "", ""
+}
+
+func extractUsage(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if u, ok := m["usage"].(map[string]interface{}); ok {
+		return u
+	}
+	return nil
+}
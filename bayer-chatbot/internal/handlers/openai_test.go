@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bayer-chatbot-service/internal/upstream"
+)
+
+func TestOpenAIToChatRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  string
+		want      string // role:content pairs sent upstream
+		wantField string
+	}{
+		{
+			name:     "developer is system",
+			messages: `[{"role":"developer","content":"be brief"},{"role":"user","content":"hi"}]`,
+			want:     "system:be brief,user:hi",
+		},
+		{
+			name: "tool turns are dropped",
+			messages: `[{"role":"user","content":"weather?"},
+				{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},
+				{"role":"tool","tool_call_id":"call_1","content":"sunny"},
+				{"role":"assistant","content":"It is sunny."},
+				{"role":"user","content":"thanks"}]`,
+			want: "user:weather?,assistant:It is sunny.,user:thanks",
+		},
+		{
+			name:     "content parts",
+			messages: `[{"role":"user","content":[{"type":"text","text":"a"},{"type":"image_url"},{"type":"text","text":"b"}]}]`,
+			want:     "user:ab",
+		},
+		{
+			name:      "problems keep the request index",
+			messages:  `[{"role":"tool","content":"x"},{"role":"user","content":"hi"},{"role":"critic","content":"x"}]`,
+			wantField: "messages[2].role",
+		},
+		{
+			name:      "assistant without content or tool calls",
+			messages:  `[{"role":"user","content":"hi"},{"role":"assistant","content":null}]`,
+			wantField: "messages[1].content",
+		},
+		{
+			name:      "only tool turns",
+			messages:  `[{"role":"tool","content":"x"}]`,
+			wantField: "messages",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ChatCompletionRequest
+			if err := json.Unmarshal([]byte(`{"model":"gpt-4o","messages":`+tt.messages+`}`), &req); err != nil {
+				t.Fatal(err)
+			}
+			chat, problems := openAIToChatRequest(req)
+			if tt.wantField != "" {
+				if len(problems) != 1 || problems[0].Field != tt.wantField {
+					t.Fatalf("problems = %+v, want one on %s", problems, tt.wantField)
+				}
+				return
+			}
+			if len(problems) > 0 {
+				t.Fatalf("problems = %+v", problems)
+			}
+			var got []string
+			for _, m := range chat.Messages {
+				got = append(got, m.Role+":"+m.Content)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("messages = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStreamFinishReason(t *testing.T) {
+	tests := []struct {
+		name      string
+		upstream  string
+		wantError bool
+		want      string
+	}{
+		{"stop", `{"choices":[{"delta":{"content":"hi"},"finish_reason":"stop"}]}`, false, "stop"},
+		{"length", `{"choices":[{"delta":{"content":"hi"},"finish_reason":"length"}]}`, false, "length"},
+		{"error", `{"choices":[{"delta":{"content":"hi"},"finish_reason":"error"}]}`, true, "stop"},
+		{"error event", `{"error":{"code":"overloaded","message":"try later"}}`, true, "stop"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "text/event-stream")
+				fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", tt.upstream)
+			}))
+			defer up.Close()
+			h := New(Options{Client: upstream.NewClient(upstream.Options{BaseURL: up.URL, AccessToken: "token"})})
+
+			body := `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+			w := httptest.NewRecorder()
+			h.ChatCompletions(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+
+			var errors int
+			var finish []string
+			for _, line := range strings.Split(w.Body.String(), "\n") {
+				data, ok := strings.CutPrefix(line, "data: ")
+				if !ok || data == "[DONE]" {
+					continue
+				}
+				var chunk struct {
+					Error   map[string]interface{} `json:"error"`
+					Choices []ChatCompletionChoice `json:"choices"`
+				}
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					t.Fatalf("chunk %q: %v", data, err)
+				}
+				if chunk.Error != nil {
+					errors++
+				}
+				for _, c := range chunk.Choices {
+					if c.FinishReason != nil {
+						finish = append(finish, *c.FinishReason)
+					}
+				}
+			}
+			if (errors == 1) != tt.wantError || errors > 1 {
+				t.Errorf("%d error objects, want error %v", errors, tt.wantError)
+			}
+			if len(finish) != 1 || finish[0] != tt.want {
+				t.Errorf("finish reasons %v, want [%s]\n%s", finish, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// Request limits enforced before anything is sent upstream.
+const (
+	maxChatMessages   = 500
+	maxMessageChars   = 100000
+	maxIDChars        = 128
+	maxToolKeys       = 32
+	maxStopSequences  = 4
+	maxStopChars      = 256
+	maxBufferLength   = 10000
+	maxTemperature    = 2
+	chatBodyLimit     = 2 << 20
+	messageRolesShown = "user|assistant|system"
+)
+
+var messageRoles = map[string]bool{"user": true, "assistant": true, "system": true}
+
+// ChatRequest is the body of POST /v1/chat and POST /v1/chat/stream.
+type ChatRequest struct {
+	Model       string        `json:"model,omitempty"`
+	AssistantID string        `json:"assistant_id,omitempty"`
+	Messages    []ChatMessage `json:"messages"`
+	ToolKeys    []string      `json:"tool_keys,omitempty"`
+	Hidden      *bool         `json:"hidden,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	MaxTokens   *int          `json:"max_tokens,omitempty"`
+	Stop        []string      `json:"stop,omitempty"`
+
+	// BufferLength is sent as a query parameter; streaming only.
+	BufferLength *int `json:"buffer_length,omitempty"`
+	// Aggregate makes POST /v1/chat stream from the upstream and answer
+	// with one ChatResult; CHAT_AGGREGATE sets the default.
+	Aggregate *bool `json:"aggregate,omitempty"`
+	// ConversationID prepends a stored conversation; never sent upstream.
+	ConversationID string `json:"conversation_id,omitempty"`
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatResult is the body of an aggregated POST /v1/chat: the streamed
+// generation in the upstream's non-streaming shape, plus citations.
+type ChatResult struct {
+	Choices   []ChatResultChoice    `json:"choices"`
+	Citations []sse.CitationPayload `json:"citations,omitempty"`
+	Usage     *sse.UsagePayload     `json:"usage,omitempty"`
+}
+
+type ChatResultChoice struct {
+	Index        int               `json:"index"`
+	Message      ChatResultMessage `json:"message"`
+	FinishReason string            `json:"finish_reason"`
+}
+
+type ChatResultMessage struct {
+	Role      string                `json:"role"`
+	Content   string                `json:"content"`
+	ToolCalls []sse.ToolCallPayload `json:"tool_calls,omitempty"`
+}
+
+func chatResultFrom(agg *sse.Aggregate) ChatResult {
+	return ChatResult{
+		Choices: []ChatResultChoice{{
+			Message:      ChatResultMessage{Role: "assistant", Content: agg.Content, ToolCalls: agg.ToolCalls},
+			FinishReason: agg.FinishReason,
+		}},
+		Citations: agg.Citations,
+		Usage:     agg.Usage,
+	}
+}
+
+// upstreamChatRequest is the body posted to /chat/agent.
+type upstreamChatRequest struct {
+	Model       string            `json:"model,omitempty"`
+	AssistantID string            `json:"assistant_id,omitempty"`
+	Messages    []upstreamMessage `json:"messages"`
+	ToolKeys    []string          `json:"tool_keys,omitempty"`
+	Hidden      *bool             `json:"hidden,omitempty"`
+	Temperature *float64          `json:"temperature,omitempty"`
+	MaxTokens   *int              `json:"max_tokens,omitempty"`
+	Stop        []string          `json:"stop,omitempty"`
+	Stream      bool              `json:"stream"`
+}
+
+type upstreamMessage struct {
+	Role     string                 `json:"role"`
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// upstreamBody builds the /chat/agent payload. Every message carries an
+// empty metadata object, which the upstream requires.
+func (req *ChatRequest) upstreamBody(stream bool) []byte {
+	msgs := make([]upstreamMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msgs = append(msgs, upstreamMessage{Role: m.Role, Content: m.Content, Metadata: map[string]interface{}{}})
+	}
+	b, _ := json.Marshal(upstreamChatRequest{
+		Model:       req.Model,
+		AssistantID: req.AssistantID,
+		Messages:    msgs,
+		ToolKeys:    req.ToolKeys,
+		Hidden:      req.Hidden,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.Stop,
+		Stream:      stream,
+	})
+	return b
+}
+
+// validate returns every problem with req; stream says whether
+// streaming-only fields are allowed, and aggregate whether /v1/chat will
+// aggregate req, explicitly or through CHAT_AGGREGATE.
+func (req *ChatRequest) validate(stream, aggregate bool) []utils.FieldError {
+	var v violations
+	if req.Model == "" && req.AssistantID == "" {
+		v.add("model", "either model or assistant_id is required")
+	}
+	v.maxChars("model", req.Model, maxIDChars)
+	v.maxChars("assistant_id", req.AssistantID, maxIDChars)
+	v.maxChars("conversation_id", req.ConversationID, maxIDChars)
+
+	v = append(v, validateMessages("messages", req.Messages)...)
+
+	if len(req.ToolKeys) > maxToolKeys {
+		v.add("tool_keys", "must contain at most "+strconv.Itoa(maxToolKeys)+" entries")
+	}
+	for i, k := range req.ToolKeys {
+		p := "tool_keys[" + strconv.Itoa(i) + "]"
+		if k == "" {
+			v.add(p, "must not be empty")
+		}
+		v.maxChars(p, k, maxIDChars)
+	}
+
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > maxTemperature) {
+		v.add("temperature", "must be between 0 and "+strconv.Itoa(maxTemperature))
+	}
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		v.add("max_tokens", "must be at least 1")
+	}
+
+	if len(req.Stop) > maxStopSequences {
+		v.add("stop", "must contain at most "+strconv.Itoa(maxStopSequences)+" entries")
+	}
+	for i, s := range req.Stop {
+		p := "stop[" + strconv.Itoa(i) + "]"
+		if s == "" {
+			v.add(p, "must not be empty")
+		}
+		v.maxChars(p, s, maxStopChars)
+	}
+
+	if req.Aggregate != nil && *req.Aggregate && stream {
+		v.add("aggregate", "is only supported by /v1/chat")
+	}
+	if req.BufferLength != nil {
+		switch {
+		case !stream && !aggregate:
+			v.add("buffer_length", "is only supported by /v1/chat/stream and aggregated /v1/chat")
+		case *req.BufferLength < 1 || *req.BufferLength > maxBufferLength:
+			v.add("buffer_length", "must be between 1 and "+strconv.Itoa(maxBufferLength))
+		}
+	}
+	return v
+}
+
+// decodeChatRequest reads and validates a chat body. It writes the error
+// response itself and returns false when the request must not proceed.
+func (h *Handler) decodeChatRequest(w http.ResponseWriter, r *http.Request, stream bool) (*ChatRequest, bool) {
+	var req ChatRequest
+	validate := func() []utils.FieldError { return req.validate(stream, !stream && h.aggregates(&req)) }
+	if !decodeBody(w, r, chatBodyLimit, &req, validate) {
+		return nil, false
+	}
+	return &req, true
+}
+
+// decodeBody strictly decodes the request body into dst and runs validate
+// on the result. Malformed JSON is a 400; any field problem is a 422 listing
+// all of them.
+func decodeBody(w http.ResponseWriter, r *http.Request, limit int64, dst interface{}, validate func() []utils.FieldError) bool {
+	body, err := utils.ReadBody(r, limit)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return false
+	}
+	problems, err := utils.DecodeStrict(body, dst)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return false
+	}
+	if validate != nil {
+		problems = mergeProblems(problems, validate())
+	}
+	if len(problems) > 0 {
+		writeValidationError(w, r, problems)
+		return false
+	}
+	return true
+}
+
+// mergeProblems appends later problems for fields not already reported, so
+// a value of the wrong type is not also reported as missing.
+func mergeProblems(first, later []utils.FieldError) []utils.FieldError {
+	seen := make(map[string]bool, len(first))
+	for _, p := range first {
+		seen[p.Field] = true
+	}
+	for _, p := range later {
+		if !seen[p.Field] {
+			first = append(first, p)
+		}
+	}
+	return first
+}
+
+// validateMessages checks role and content of each message under field.
+func validateMessages(field string, msgs []ChatMessage) []utils.FieldError {
+	var v violations
+	switch {
+	case len(msgs) == 0:
+		v.add(field, "must contain at least one message")
+	case len(msgs) > maxChatMessages:
+		v.add(field, "must contain at most "+strconv.Itoa(maxChatMessages)+" messages")
+	}
+	for i, m := range msgs {
+		p := field + "[" + strconv.Itoa(i) + "]"
+		switch {
+		case m.Role == "":
+			v.add(p+".role", "is required")
+		case !messageRoles[m.Role]:
+			v.add(p+".role", "must be one of "+messageRolesShown)
+		}
+		if m.Content == "" {
+			v.add(p+".content", "is required")
+		}
+		v.maxChars(p+".content", m.Content, maxMessageChars)
+	}
+	return v
+}
+
+// violations collects field errors in the order they are found.
+type violations []utils.FieldError
+
+func (v *violations) add(field, problem string) {
+	*v = append(*v, utils.FieldError{Field: field, Problem: problem})
+}
+
+func (v *violations) maxChars(field, s string, limit int) {
+	if len(s) > limit && utf8.RuneCountInString(s) > limit {
+		v.add(field, "must be at most "+strconv.Itoa(limit)+" characters")
+	}
+}
+
+// validPathID checks an identifier taken from the URL path.
+func validPathID(field, id string) []utils.FieldError {
+	var v violations
+	switch {
+	case strings.TrimSpace(id) == "":
+		v.add(field, "is required")
+	case utf8.RuneCountInString(id) > maxIDChars:
+		v.add(field, "must be at most "+strconv.Itoa(maxIDChars)+" characters")
+	}
+	return v
+}
+
+// Model is one entry of GET /v1/models. Fields beyond the known ones are
+// kept as the upstream sent them.
+type Model struct {
+	ID      string                 `json:"id"`
+	Object  string                 `json:"object"`
+	OwnedBy string                 `json:"owned_by,omitempty"`
+	Extra   map[string]interface{} `json:"-"`
+}
+
+// ModelList is the response of GET /v1/models.
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+func (m Model) MarshalJSON() ([]byte, error) {
+	type plain Model
+	return marshalWithExtra(plain(m), m.Extra)
+}
+
+// marshalWithExtra encodes v and merges extra underneath its fields.
+func marshalWithExtra(v interface{}, extra map[string]interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return b, err
+	}
+	var known map[string]interface{}
+	if err := json.Unmarshal(b, &known); err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{}, len(known)+len(extra))
+	for k, x := range extra {
+		out[k] = x
+	}
+	for k, x := range known {
+		out[k] = x
+	}
+	return json.Marshal(out)
+}
+
+// listItems finds the list in an upstream list response: a bare array, or
+// an array under one of keys.
+func listItems(body []byte, keys ...string) ([]interface{}, bool) {
+	var doc interface{}
+	if json.Unmarshal(body, &doc) != nil {
+		return nil, false
+	}
+	if items, ok := doc.([]interface{}); ok {
+		return items, true
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	for _, k := range keys {
+		if items, ok := obj[k].([]interface{}); ok {
+			return items, true
+		}
+	}
+	return nil, false
+}
+
+// parseModelList accepts ["id", ...], {"data":[...]} and {"models":[...]}
+// with string or object entries.
+func parseModelList(body []byte) (ModelList, bool) {
+	items, ok := listItems(body, "data", "models")
+	if !ok {
+		return ModelList{}, false
+	}
+	list := ModelList{Object: "list", Data: make([]Model, 0, len(items))}
+	for _, item := range items {
+		m := Model{Object: "model"}
+		switch x := item.(type) {
+		case string:
+			m.ID = x
+		case map[string]interface{}:
+			m.Extra = x
+			m.ID = firstString(x, "id", "name", "model")
+			m.OwnedBy = firstString(x, "owned_by")
+			delete(x, "id")
+			delete(x, "object")
+			delete(x, "owned_by")
+		}
+		if m.ID == "" {
+			continue
+		}
+		list.Data = append(list.Data, m)
+	}
+	return list, true
+}
+
+func firstString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if s, ok := m[k].(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
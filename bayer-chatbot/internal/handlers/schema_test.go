@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeChatRequestBufferLength(t *testing.T) {
+	tests := []struct {
+		name          string
+		extra         string // fields before the common ones
+		stream        bool
+		chatAggregate bool
+		wantField     string
+	}{
+		{"stream", "", true, false, ""},
+		{"plain chat", "", false, false, "buffer_length"},
+		{"aggregate field", `"aggregate":true,`, false, false, ""},
+		{"CHAT_AGGREGATE default", "", false, true, ""},
+		{"CHAT_AGGREGATE turned off", `"aggregate":false,`, false, true, "buffer_length"},
+		{"aggregate on a stream", `"aggregate":true,`, true, false, "aggregate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			h.cfg.ChatAggregate = tt.chatAggregate
+			body := `{` + tt.extra + `"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"buffer_length":6}`
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat", strings.NewReader(body))
+
+			_, ok := h.decodeChatRequest(w, r, tt.stream)
+			if ok != (tt.wantField == "") {
+				t.Fatalf("ok = %v, response %d %s", ok, w.Code, w.Body)
+			}
+			if !ok && (w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"field":"`+tt.wantField+`"`)) {
+				t.Errorf("response %d %s, want 422 on %s", w.Code, w.Body, tt.wantField)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
+	"bayer-chatbot-service/internal/websocket"
+)
+
+var (
+	errWSCanceled = errors.New("canceled by the client")
+	errWSClosed   = errors.New("the connection closed")
+)
+
+const wsShuttingDown = "the service is shutting down"
+
+// WSClientMessage is a message sent by the client on /v1/chat/ws. Type is
+// "chat", which starts a generation of Request under the client-chosen ID,
+// or "cancel", which stops the generation with ID.
+type WSClientMessage struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Request *ChatRequest `json:"request,omitempty"`
+}
+
+// WSServerMessage is a message sent by the service on /v1/chat/ws. Type is a
+// stream event name and Data its payload, as on /v1/chat/stream; ID names
+// the generation. Every chat message is answered by exactly one done.
+type WSServerMessage struct {
+	Type string      `json:"type"`
+	ID   string      `json:"id,omitempty"`
+	Data interface{} `json:"data"`
+}
+
+// WSError is the data of an error message; Details lists field problems of
+// a rejected chat message.
+type WSError struct {
+	Code    string             `json:"code"`
+	Message string             `json:"message"`
+	Details []utils.FieldError `json:"details,omitempty"`
+}
+
+// ChatWebSocket serves GET /v1/chat/ws, a WebSocket carrying any number of
+// concurrent generations. Generations are tied to the connection: closing it
+// cancels them.
+func (h *Handler) ChatWebSocket(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	conn, err := websocket.Upgrade(w, r, websocket.Options{MaxMessage: chatBodyLimit, CheckOrigin: h.allowedOrigin})
+	if err != nil {
+		if errors.Is(err, websocket.ErrOrigin) {
+			writeError(w, r, http.StatusForbidden, "forbidden_origin", "origin "+r.Header.Get("origin")+" may not open a WebSocket")
+			return
+		}
+		var he *websocket.HandshakeError
+		if errors.As(err, &he) {
+			w.Header().Set("upgrade", "websocket")
+			w.Header().Set("sec-websocket-version", "13")
+			writeError(w, r, http.StatusUpgradeRequired, "upgrade_required", he.Error())
+			return
+		}
+		h.logr.Ctx(r.Context()).Error("ws.upgrade_error", map[string]interface{}{"error": err.Error()})
+		writeError(w, r, http.StatusInternalServerError, "internal_error", "websocket upgrade failed")
+		return
+	}
+
+	meter := h.startStream(r, "chatWebSocket", w, started)
+	defer meter.finish()
+
+	s := &wsSession{h: h, r: r, conn: conn, gens: map[string]wsGeneration{}}
+	if !h.sockets.add(s) {
+		_ = conn.Close(websocket.CloseGoingAway, wsShuttingDown)
+		return
+	}
+	defer h.sockets.remove(s)
+	s.ctx, s.cancel = context.WithCancelCause(r.Context())
+	s.run()
+}
+
+// DrainWebSockets stops every /v1/chat/ws connection from starting
+// generations; each is closed with 1001 once its running generations have
+// sent their done. http.Server.Shutdown does not track hijacked connections,
+// so it is meant for http.Server.RegisterOnShutdown.
+func (h *Handler) DrainWebSockets() {
+	h.sockets.drain()
+}
+
+// WaitWebSockets waits until every /v1/chat/ws connection has closed, or
+// ctx is done.
+func (h *Handler) WaitWebSockets(ctx context.Context) error {
+	return h.sockets.wait(ctx)
+}
+
+// wsSessions tracks the open /v1/chat/ws connections.
+type wsSessions struct {
+	mu       sync.Mutex
+	open     map[*wsSession]bool
+	draining bool
+	wg       sync.WaitGroup
+}
+
+func newWSSessions() *wsSessions {
+	return &wsSessions{open: map[*wsSession]bool{}}
+}
+
+// add registers s unless the service is shutting down.
+func (ws *wsSessions) add(s *wsSession) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.draining {
+		return false
+	}
+	ws.open[s] = true
+	ws.wg.Add(1)
+	return true
+}
+
+func (ws *wsSessions) remove(s *wsSession) {
+	ws.mu.Lock()
+	delete(ws.open, s)
+	ws.mu.Unlock()
+	ws.wg.Done()
+}
+
+func (ws *wsSessions) drain() {
+	ws.mu.Lock()
+	ws.draining = true
+	open := make([]*wsSession, 0, len(ws.open))
+	for s := range ws.open {
+		open = append(open, s)
+	}
+	ws.mu.Unlock()
+	for _, s := range open {
+		s.drain()
+	}
+}
+
+func (ws *wsSessions) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// allowedOrigin admits WebSocket upgrades from CORS_ALLOW_ORIGIN, from any
+// page when it is "*", and from clients that send no Origin. Browsers always
+// send one, so this keeps other sites' pages out.
+func (h *Handler) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("origin")
+	return origin == "" || h.cfg.CORSAllowOrigin == "*" || origin == h.cfg.CORSAllowOrigin
+}
+
+// wsSession is one /v1/chat/ws connection.
+type wsSession struct {
+	h      *Handler
+	r      *http.Request
+	conn   *websocket.Conn
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	gens     map[string]wsGeneration
+	running  int  // generation goroutines, until their done is sent
+	draining bool // set by drain; no generations start
+}
+
+// wsGeneration is a running generation: cancel stops it, release frees its
+// rate-limit slots.
+type wsGeneration struct {
+	cancel  context.CancelCauseFunc
+	release func()
+}
+
+// run reads client messages until the connection closes, then cancels and
+// waits for the generations still running.
+func (s *wsSession) run() {
+	go s.keepAlive()
+
+	code := websocket.CloseNormal
+	for {
+		op, msg, err := s.conn.ReadMessage()
+		if err != nil {
+			if s.ctx.Err() != nil {
+				// Shutdown or a failed write, not the client.
+				code = websocket.CloseGoingAway
+			}
+			break
+		}
+		if op != websocket.OpText {
+			s.send(WSServerMessage{Type: sse.EventError, Data: WSError{Code: "invalid_request", Message: "messages must be JSON text"}})
+			continue
+		}
+		s.handle(msg)
+	}
+
+	s.cancel(errWSClosed)
+	s.wg.Wait()
+	_ = s.conn.Close(code, "")
+}
+
+// keepAlive pings the client every heartbeat interval so proxies keep an
+// idle connection open. When the session's context ends, e.g. at the
+// shutdown deadline, the canceled generations still send their done before
+// the connection closes.
+func (s *wsSession) keepAlive() {
+	var tick <-chan time.Time
+	if every := s.h.cfg.SSEHeartbeatInterval; every > 0 {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			if err := s.conn.Ping(); err != nil {
+				s.cancel(err)
+				return
+			}
+		case <-s.ctx.Done():
+			// Closing unblocks ReadMessage.
+			s.drain()
+			return
+		}
+	}
+}
+
+func (s *wsSession) handle(raw []byte) {
+	var msg WSClientMessage
+	problems, err := utils.DecodeStrict(raw, &msg)
+	if err != nil {
+		s.send(WSServerMessage{Type: sse.EventError, Data: WSError{Code: "invalid_request", Message: err.Error()}})
+		return
+	}
+	if msg.ID == "" {
+		problems = append(problems, utils.FieldError{Field: "id", Problem: "is required"})
+	} else if len(msg.ID) > maxIDChars {
+		problems = append(problems, utils.FieldError{Field: "id", Problem: "must be at most " + strconv.Itoa(maxIDChars) + " characters"})
+	}
+
+	switch msg.Type {
+	case "chat":
+		if msg.Request == nil {
+			problems = append(problems, utils.FieldError{Field: "request", Problem: "is required"})
+		} else {
+			nested := msg.Request.validate(true, false)
+			for i := range nested {
+				nested[i].Field = "request." + nested[i].Field
+			}
+			problems = mergeProblems(problems, nested)
+		}
+		if len(problems) > 0 {
+			s.reject(msg.ID, problems)
+			return
+		}
+		s.start(msg.ID, msg.Request)
+	case "cancel":
+		if len(problems) > 0 {
+			s.send(WSServerMessage{Type: sse.EventError, ID: msg.ID, Data: WSError{Code: "validation_failed", Message: "request validation failed", Details: problems}})
+			return
+		}
+		s.stop(msg.ID)
+	default:
+		problems = append(problems, utils.FieldError{Field: "type", Problem: `must be "chat" or "cancel"`})
+		s.send(WSServerMessage{Type: sse.EventError, ID: msg.ID, Data: WSError{Code: "validation_failed", Message: "request validation failed", Details: problems}})
+	}
+}
+
+// reject answers a chat message that did not start a generation. A running
+// generation with the same id keeps its own done.
+func (s *wsSession) reject(id string, problems []utils.FieldError) {
+	s.send(WSServerMessage{Type: sse.EventError, ID: id, Data: WSError{Code: "validation_failed", Message: "request validation failed", Details: problems}})
+	s.mu.Lock()
+	_, busy := s.gens[id]
+	s.mu.Unlock()
+	if id != "" && !busy {
+		s.send(WSServerMessage{Type: sse.EventDone, ID: id, Data: sse.DonePayload{FinishReason: "error"}})
+	}
+}
+
+// start runs req under id unless id is taken, the service is shutting down,
+// the connection is at its generation limit or a rate limit refuses it.
+// Every generation counts against the caller's and model's limits on its own.
+func (s *wsSession) start(id string, req *ChatRequest) {
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		s.fail(id, "shutting_down", wsShuttingDown)
+		return
+	}
+	if _, busy := s.gens[id]; busy {
+		s.mu.Unlock()
+		// No done: it would be mistaken for the running generation's.
+		s.send(WSServerMessage{Type: sse.EventError, ID: id, Data: WSError{Code: "duplicate_id", Message: "a generation with this id is running"}})
+		return
+	}
+	if max := s.h.cfg.WSMaxGenerations; max > 0 && len(s.gens) >= max {
+		s.mu.Unlock()
+		s.fail(id, "too_many_generations", "at most "+strconv.Itoa(max)+" generations may run per connection")
+		return
+	}
+	release, err := acquireLimits(s.r, req.Model, req.AssistantID)
+	if err != nil {
+		s.mu.Unlock()
+		s.fail(id, "rate_limited", err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	s.gens[id] = wsGeneration{cancel: cancel, release: release}
+	s.running++
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		defer s.finished()
+		defer cancel(nil)
+		defer s.release(id)
+		s.generate(ctx, id, req)
+	}()
+}
+
+// drain stops s from starting generations and closes it once none run.
+func (s *wsSession) drain() {
+	s.mu.Lock()
+	s.draining = true
+	idle := s.running == 0
+	s.mu.Unlock()
+	if idle {
+		_ = s.conn.Close(websocket.CloseGoingAway, wsShuttingDown)
+	}
+}
+
+// finished runs after a generation sent its done; the last one of a
+// draining session closes the connection.
+func (s *wsSession) finished() {
+	s.mu.Lock()
+	s.running--
+	last := s.draining && s.running == 0
+	s.mu.Unlock()
+	if last {
+		_ = s.conn.Close(websocket.CloseGoingAway, wsShuttingDown)
+	}
+}
+
+// release frees id for reuse and the generation's rate-limit slots. It runs
+// before a generation's done is sent so the client may reuse the id as soon
+// as it sees done.
+func (s *wsSession) release(id string) {
+	s.mu.Lock()
+	gen, ok := s.gens[id]
+	delete(s.gens, id)
+	s.mu.Unlock()
+	if ok {
+		gen.release()
+	}
+}
+
+// stop cancels the generation with id; its done follows from generate.
+func (s *wsSession) stop(id string) {
+	s.mu.Lock()
+	gen, ok := s.gens[id]
+	s.mu.Unlock()
+	if !ok {
+		s.send(WSServerMessage{Type: sse.EventError, ID: id, Data: WSError{Code: "not_found", Message: "no generation with this id is running"}})
+		return
+	}
+	gen.cancel(errWSCanceled)
+}
+
+// generate relays one generation's normalized events to the client.
+func (s *wsSession) generate(ctx context.Context, id string, req *ChatRequest) {
+	convID, fresh, err := s.h.loadConversation(ctx, callerName(s.r), req)
+	if err != nil {
+		code := "internal_error"
+		var invalid errString
+		switch {
+		case errors.Is(err, conversations.ErrNotFound):
+			code = "not_found"
+		case errors.As(err, &invalid):
+			code = "invalid_request"
+		}
+		s.fail(id, code, err.Error())
+		return
+	}
+
+	query := url.Values{}
+	if req.BufferLength != nil {
+		query.Set("buffer_length", strconv.Itoa(*req.BufferLength))
+	}
+	rid := s.r.Header.Get("x-request-id")
+	res, err := s.h.client.DoSSE(ctx, "/chat/agent", query, req.upstreamBody(true), rid)
+	if err != nil {
+		if ctx.Err() != nil {
+			s.fail(id, "canceled", context.Cause(ctx).Error())
+			return
+		}
+		var ue *upstream.Error
+		if !errors.As(err, &ue) {
+			ue = &upstream.Error{Code: upstream.CodeUnreachable, Message: err.Error()}
+		}
+		_, code := upstreamErrorStatus(ue)
+		s.fail(id, code, ue.Message)
+		return
+	}
+	// The connection is pinged by keepAlive; only the idle limit applies.
+	body := utils.WatchStream(ctx, res.Body, utils.StreamTimeouts{MaxIdle: s.h.cfg.UpstreamIdleTimeout}, nil)
+	defer body.Close()
+
+	var reply strings.Builder
+	done, failed := false, false
+	_ = sse.Relay(body, func(ev sse.Event) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch p := ev.Payload.(type) {
+		case sse.DeltaPayload:
+			reply.WriteString(p.Delta)
+		case sse.ErrorPayload:
+			failed = true
+		}
+		if ev.Type == sse.EventDone {
+			done = true
+			s.release(id)
+		}
+		// A failed send cancels the session and so ctx.
+		s.send(WSServerMessage{Type: ev.Type, ID: id, Data: ev.Payload})
+		return ctx.Err()
+	})
+	if !done {
+		// Relay always ends with done unless emit failed, which only
+		// happens once ctx is canceled.
+		s.fail(id, "canceled", context.Cause(ctx).Error())
+		return
+	}
+	if !failed {
+		s.h.saveTurn(s.r, convID, fresh, reply.String())
+	}
+}
+
+// fail ends generation id with an error and done.
+func (s *wsSession) fail(id, code, message string) {
+	s.send(WSServerMessage{Type: sse.EventError, ID: id, Data: WSError{Code: code, Message: message}})
+	s.release(id)
+	s.send(WSServerMessage{Type: sse.EventDone, ID: id, Data: sse.DonePayload{FinishReason: "error"}})
+}
+
+// send writes one message; a failed write ends the session.
+func (s *wsSession) send(msg WSServerMessage) {
+	if err := s.conn.WriteJSON(msg); err != nil {
+		s.cancel(err)
+	}
+}
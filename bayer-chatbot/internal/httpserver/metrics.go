@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"bayer-chatbot-service/internal/metrics"
+)
+
+// httpMetrics are recorded for every request by withHTTPLogging.
+type httpMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	bytes    *metrics.CounterVec
+	inFlight *metrics.GaugeVec
+	// route maps a request to its route name so paths carrying IDs
+	// do not explode label cardinality.
+	route func(*http.Request) string
+}
+
+func newHTTPMetrics(reg *metrics.Registry, route func(*http.Request) string) *httpMetrics {
+	return &httpMetrics{
+		requests: reg.Counter("http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status"),
+		duration: reg.Histogram("http_request_duration_seconds", "HTTP request latency by route and method.", nil, "route", "method"),
+		bytes:    reg.Counter("http_response_bytes_total", "Response body bytes written by route.", "route"),
+		inFlight: reg.Gauge("http_requests_in_flight", "Requests currently being served."),
+		route:    route,
+	}
+}
+
+func (m *httpMetrics) begin() {
+	if m == nil {
+		return
+	}
+	m.inFlight.Inc()
+}
+
+func (m *httpMetrics) end(r *http.Request, route string, rw *statusCapturingResponseWriter, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.inFlight.Dec()
+	m.requests.Inc(route, r.Method, strconv.Itoa(rw.status))
+	m.duration.Observe(time.Since(start).Seconds(), route, r.Method)
+	m.bytes.Add(float64(rw.bytes), route)
+}
+
+func (m *httpMetrics) routeOf(r *http.Request) string {
+	if m == nil || m.route == nil {
+		return r.URL.Path
+	}
+	return m.route(r)
+}
@@ -1,15 +1,23 @@
 package httpserver
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"bayer-chatbot-service/internal/auth"
 	"bayer-chatbot-service/internal/config"
 	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/upstream"
+	"bayer-chatbot-service/internal/utils"
 )
 
 func withCORS(cfg config.Config, next http.Handler) http.Handler {
@@ -44,15 +52,150 @@ func withRequestID(next http.Handler) http.Handler {
 	})
 }
 
-func withHTTPLogging(cfg config.Config, logr *logger.Logger, next http.Handler) http.Handler {
+// publicPaths are reachable without an API key.
+var publicPaths = map[string]bool{
+	"/health":       true,
+	"/livez":        true,
+	"/readyz":       true,
+	"/metrics":      true,
+	"/openapi.json": true,
+}
+
+// withAuth requires "Authorization: Bearer <key>" on every non-public path
+// when at least one API key is configured, and attaches the caller identity
+// to the request context.
+func withAuth(keys *auth.KeyStore, logr *logger.Logger, next http.Handler) http.Handler {
+	if keys.Len() == 0 {
+		return next
+	}
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !cfg.DebugHTTP {
+		if publicPaths[r.URL.Path] {
 			next.ServeHTTP(w, r)
 			return
 		}
 
+		key := ""
+		if h := r.Header.Get("authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+			key = strings.TrimSpace(h[7:])
+		}
+		id, ok := keys.Verify(key)
+		if !ok {
+			logr.Ctx(r.Context()).Warn("auth.rejected", map[string]interface{}{
+				"path":   r.URL.Path,
+				"reason": authFailureReason(key),
+			})
+			w.Header().Set("www-authenticate", `Bearer realm="bayer-chatbot-service"`)
+			utils.WriteJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"error":     "unauthorized",
+				"message":   "missing or invalid API key",
+				"requestId": r.Header.Get("x-request-id"),
+			})
+			return
+		}
+
+		if m := metaFromContext(r.Context()); m != nil {
+			m.setCaller(id.Name)
+		}
+		ctx := auth.WithIdentity(r.Context(), id)
+		ctx = logger.WithContext(ctx, logr.Ctx(ctx).With(map[string]interface{}{"caller": id.Name}))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func authFailureReason(key string) string {
+	if key == "" {
+		return "missing_key"
+	}
+	return "unknown_key"
+}
+
+// callerTokenHeader lets callers supply their own upstream access token.
+const callerTokenHeader = "x-baychatgpt-accesstoken"
+
+// withCallerToken resolves the caller's own upstream token from the inbound
+// header or, failing that, from the token mapped to the authenticated
+// identity. The header is removed so it cannot reach logs downstream; the
+// upstream client decides whether to use the token based on its mode.
+func withCallerToken(tokens map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimSpace(r.Header.Get(callerTokenHeader))
+		r.Header.Del(callerTokenHeader)
+		if token == "" {
+			if id, ok := auth.FromContext(r.Context()); ok {
+				token = tokens[id.Name]
+			}
+		}
+		if token != "" {
+			r = r.WithContext(upstream.WithCallerToken(r.Context(), token))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestMeta collects facts learned by inner middleware (such as the caller)
+// so the outer logging middleware can report them.
+type requestMeta struct {
+	mu     sync.Mutex
+	caller string
+}
+
+type requestMetaKey struct{}
+
+func metaFromContext(ctx context.Context) *requestMeta {
+	m, _ := ctx.Value(requestMetaKey{}).(*requestMeta)
+	return m
+}
+
+func (m *requestMeta) setCaller(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.caller = name
+}
+
+func (m *requestMeta) getCaller() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.caller
+}
+
+// withUpstreamAttempts surfaces the number of upstream attempts made for a
+// request in the x-upstream-attempts response header.
+func withUpstreamAttempts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var mu sync.Mutex
+		ctx := upstream.WithAttemptsReporter(r.Context(), func(n int) {
+			mu.Lock()
+			defer mu.Unlock()
+			w.Header().Set(upstream.AttemptsHeader, intToString(n))
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withHTTPLogging attaches a request-scoped logger carrying the request id
+// and route, records request metrics and, when DEBUG_HTTP is set, logs each
+// request and response. It must run inside withRequestID.
+func withHTTPLogging(cfg config.Config, logr *logger.Logger, m *httpMetrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		rid := r.Header.Get("x-request-id")
+		route := m.routeOf(r)
+		rw := &statusCapturingResponseWriter{ResponseWriter: w, status: 200}
+		m.begin()
+		defer m.end(r, route, rw, start)
+
+		reqLog := logr.With(map[string]interface{}{
+			"requestId": r.Header.Get("x-request-id"),
+			"route":     route,
+		})
+		meta := &requestMeta{}
+		ctx := logger.WithContext(r.Context(), reqLog)
+		r = r.WithContext(context.WithValue(ctx, requestMetaKey{}, meta))
+
+		if !cfg.DebugHTTP {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
 		var bodyPreview string
 		if cfg.DebugHTTPBody && (r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch) {
 			// Read and restore body for downstream handlers.
@@ -69,31 +212,37 @@ func withHTTPLogging(cfg config.Config, logr *logger.Logger, next http.Handler)
 		}
 
 		fields := map[string]interface{}{
-			"requestId": rid,
-			"method":    r.Method,
-			"path":      r.URL.Path,
+			"method": r.Method,
+			"path":   r.URL.Path,
 		}
 		if bodyPreview != "" {
 			fields["bodyPreview"] = bodyPreview
 		}
-		logr.Info("http.request", fields)
+		reqLog.Info("http.request", fields)
 
-		rw := &statusCapturingResponseWriter{ResponseWriter: w, status: 200}
 		next.ServeHTTP(rw, r)
 
-		logr.Info("http.response", map[string]interface{}{
-			"requestId": rid,
-			"method":    r.Method,
-			"path":      r.URL.Path,
-			"status":    rw.status,
-			"ms":        time.Since(start).Milliseconds(),
-		})
+		// The caller is only known once withAuth has run, further in.
+		respFields := map[string]interface{}{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": rw.status,
+			"ms":     time.Since(start).Milliseconds(),
+		}
+		if caller := meta.getCaller(); caller != "" {
+			respFields["caller"] = caller
+		}
+		reqLog.Info("http.response", respFields)
 	})
 }
 
+// statusCapturingResponseWriter records the status and body size. It keeps
+// http.Flusher working for SSE and exposes the underlying writer through
+// Unwrap for http.ResponseController.
 type statusCapturingResponseWriter struct {
 	http.ResponseWriter
 	status int
+	bytes  int64
 }
 
 func (w *statusCapturingResponseWriter) WriteHeader(statusCode int) {
@@ -101,6 +250,32 @@ func (w *statusCapturingResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+func (w *statusCapturingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusCapturingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack records the switch to another protocol; the caller owns the
+// connection afterwards.
+func (w *statusCapturingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+func (w *statusCapturingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 func newID() string {
 	var b [16]byte
 	_, _ = rand.Read(b[:])
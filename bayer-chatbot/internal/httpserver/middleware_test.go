@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bayer-chatbot-service/internal/auth"
+)
+
+func TestWithAuth(t *testing.T) {
+	sum := sha256.Sum256([]byte("alice-key"))
+	keys, err := auth.ParseKeys("alice:" + hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantStatus int
+		wantCaller string
+	}{
+		{"bearer", "/v1/models", "Bearer alice-key", http.StatusOK, "alice"},
+		{"scheme is case-insensitive", "/v1/models", "bearer  alice-key ", http.StatusOK, "alice"},
+		{"missing", "/v1/models", "", http.StatusUnauthorized, ""},
+		{"unknown key", "/v1/models", "Bearer mallory-key", http.StatusUnauthorized, ""},
+		{"other scheme", "/v1/models", "Basic alice-key", http.StatusUnauthorized, ""},
+		{"scheme only", "/v1/models", "Bearer ", http.StatusUnauthorized, ""},
+		{"public path", "/health", "", http.StatusOK, ""},
+		{"public path with a bad key", "/readyz", "Bearer mallory-key", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := ""
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if id, ok := auth.FromContext(r.Context()); ok {
+					caller = id.Name
+				}
+			})
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				r.Header.Set("authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			withAuth(keys, nil, next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if caller != tt.wantCaller {
+				t.Errorf("caller %q, want %q", caller, tt.wantCaller)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("www-authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestWithAuthDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	for _, keys := range []*auth.KeyStore{nil, {}} {
+		w := httptest.NewRecorder()
+		withAuth(keys, nil, next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("status %d without keys, want 200", w.Code)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"bayer-chatbot-service/internal/conversations"
+	"bayer-chatbot-service/internal/handlers"
+	"bayer-chatbot-service/internal/jobs"
+	"bayer-chatbot-service/internal/openapi"
+)
+
+// apiSpec describes every route registered by registerRoutes. Schemas come
+// from the handler types; server_test.go fails when a route is missing.
+func apiSpec(withMetrics bool) *openapi.Document {
+	d := openapi.New(openapi.Info{
+		Title:       "bayer-chatbot-service",
+		Version:     "1.0.0",
+		Description: "Proxy to the myGenAssist chat API. When API keys are configured, every route except /health, /livez, /readyz, /metrics and /openapi.json requires `Authorization: Bearer <key>`.",
+	})
+	d.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"apiKey": {Type: "http", Scheme: "bearer"},
+	}
+
+	errResp := d.JSONResponse("Error", handlers.ErrorBody{})
+	op := func(id, summary, tag string, public bool) *openapi.Operation {
+		o := &openapi.Operation{
+			OperationID: id,
+			Summary:     summary,
+			Tags:        []string{tag},
+			Responses:   map[string]openapi.Response{"default": errResp},
+		}
+		if !public {
+			o.Security = []map[string][]string{{"apiKey": {}}}
+		}
+		return o
+	}
+	withBody := func(o *openapi.Operation, body interface{}) *openapi.Operation {
+		o.RequestBody = d.JSONBody(body)
+		o.Responses["400"] = d.JSONResponse("Malformed JSON", handlers.ErrorBody{})
+		o.Responses["422"] = d.JSONResponse("Request failed validation; details lists every problem", handlers.ErrorBody{})
+		return o
+	}
+	admin := func(o *openapi.Operation) *openapi.Operation {
+		o.Description = "Requires an API key listed in ADMIN_KEYS, unless BAYER_CHAT_TOKEN_MODE is passthrough."
+		o.Responses["403"] = d.JSONResponse("Caller may not change assistants", handlers.ErrorBody{})
+		return o
+	}
+	sse := openapi.TextResponse("Server-sent events", "text/event-stream")
+
+	o := op("health", "Service health and circuit states", "health", true)
+	o.Responses["200"] = d.JSONResponse("OK", handlers.HealthResponse{})
+	d.Add(http.MethodGet, "/health", o)
+
+	o = op("livez", "Liveness", "health", true)
+	o.Responses["200"] = d.JSONResponse("Process is serving", handlers.LivenessResponse{})
+	d.Add(http.MethodGet, "/livez", o)
+
+	o = op("readyz", "Readiness", "health", true)
+	o.Responses["200"] = d.JSONResponse("Ready", handlers.ReadinessResponse{})
+	o.Responses["503"] = d.JSONResponse("Not ready", handlers.ReadinessResponse{})
+	d.Add(http.MethodGet, "/readyz", o)
+
+	if withMetrics {
+		o = op("metrics", "Prometheus metrics", "health", true)
+		o.Responses["200"] = openapi.TextResponse("Prometheus text format", "text/plain")
+		d.Add(http.MethodGet, "/metrics", o)
+	}
+
+	o = op("openapi", "This document", "health", true)
+	o.Responses["200"] = openapi.Response{Description: "OpenAPI 3.1 document", Content: map[string]openapi.MediaType{
+		"application/json": {Schema: openapi.Schema{"type": "object"}},
+	}}
+	d.Add(http.MethodGet, "/openapi.json", o)
+
+	o = op("listModels", "List models", "models", false)
+	o.Responses["200"] = d.JSONResponse("Models", handlers.ModelList{})
+	d.Add(http.MethodGet, "/v1/models", o)
+
+	o = op("listTools", "List tools usable in tool_keys", "assistants", false)
+	o.Responses["200"] = d.JSONResponse("Tools", handlers.ToolList{})
+	d.Add(http.MethodGet, "/v1/tools", o)
+
+	o = op("listAssistants", "List assistants", "assistants", false)
+	o.Parameters = []openapi.Parameter{
+		openapi.QueryParam("limit", "integer", "Page size, 1-100"),
+		openapi.QueryParam("offset", "integer", "Entries to skip"),
+		openapi.QueryParam("search", "string", "Filter by name"),
+	}
+	o.Responses["200"] = d.JSONResponse("Assistants", handlers.AssistantList{})
+	o.Responses["422"] = d.JSONResponse("Invalid query parameters", handlers.ErrorBody{})
+	d.Add(http.MethodGet, "/v1/assistants", o)
+
+	o = admin(withBody(op("createAssistant", "Create an assistant", "assistants", false), handlers.AssistantInput{}))
+	o.Responses["201"] = d.JSONResponse("Created", handlers.Assistant{})
+	d.Add(http.MethodPost, "/v1/assistants", o)
+
+	assistantParam := openapi.PathParam("assistantId", "Assistant id")
+
+	o = op("getAssistant", "Get an assistant", "assistants", false)
+	o.Parameters = []openapi.Parameter{assistantParam}
+	o.Responses["200"] = d.JSONResponse("Assistant", handlers.Assistant{})
+	d.Add(http.MethodGet, "/v1/assistants/{assistantId}", o)
+
+	o = admin(withBody(op("updateAssistant", "Update an assistant", "assistants", false), handlers.AssistantUpdate{}))
+	o.Parameters = []openapi.Parameter{assistantParam}
+	o.Responses["200"] = d.JSONResponse("Assistant", handlers.Assistant{})
+	d.Add(http.MethodPatch, "/v1/assistants/{assistantId}", o)
+
+	o = admin(op("deleteAssistant", "Delete an assistant", "assistants", false))
+	o.Parameters = []openapi.Parameter{assistantParam}
+	o.Responses["204"] = openapi.Response{Description: "Deleted"}
+	d.Add(http.MethodDelete, "/v1/assistants/{assistantId}", o)
+
+	o = op("listAssistantUsers", "List users of an assistant", "assistants", false)
+	o.Parameters = []openapi.Parameter{assistantParam}
+	o.Responses["200"] = d.JSONResponse("Users", handlers.AssistantUserList{})
+	d.Add(http.MethodGet, "/v1/assistants/{assistantId}/users", o)
+
+	o = admin(withBody(op("addAssistantUser", "Share an assistant with a user", "assistants", false), handlers.AssistantUserInput{}))
+	o.Parameters = []openapi.Parameter{assistantParam}
+	o.Responses["201"] = d.JSONResponse("Added", handlers.AssistantUser{})
+	d.Add(http.MethodPost, "/v1/assistants/{assistantId}/users", o)
+
+	o = admin(op("removeAssistantUser", "Remove a user from an assistant", "assistants", false))
+	o.Parameters = []openapi.Parameter{assistantParam, openapi.PathParam("userId", "User id or email")}
+	o.Responses["204"] = openapi.Response{Description: "Removed"}
+	d.Add(http.MethodDelete, "/v1/assistants/{assistantId}/users/{userId}", o)
+
+	o = withBody(op("chat", "Chat (single JSON response)", "chat", false), handlers.ChatRequest{})
+	o.Description = "With aggregate (or CHAT_AGGREGATE), the upstream is called in streaming mode and the events are folded into one ChatResult."
+	o.Responses["200"] = openapi.Response{Description: "Upstream response unchanged, or a ChatResult when aggregated", Content: map[string]openapi.MediaType{
+		"application/json": {Schema: openapi.Schema{"anyOf": []interface{}{openapi.Schema{"type": "object"}, d.SchemaOf(handlers.ChatResult{})}}},
+	}}
+	d.Add(http.MethodPost, "/v1/chat", o)
+
+	o = withBody(op("chatStream", "Chat (server-sent events)", "chat", false), handlers.ChatRequest{})
+	o.Description = "Emits delta, tool_call, citation, usage, error and done events; done is always last. Events carry numeric ids and the x-stream-id header names the stream for resumeChatStream."
+	o.Parameters = []openapi.Parameter{openapi.QueryParam("raw", "string", "1 relays the upstream bytes untouched; raw streams are not resumable")}
+	o.Responses["200"] = sse
+	o.Responses["503"] = d.JSONResponse("STREAM_CAPACITY streams are running", handlers.ErrorBody{})
+	d.Add(http.MethodPost, "/v1/chat/stream", o)
+
+	o = op("resumeChatStream", "Resume a chat stream after a dropped connection", "chat", false)
+	o.Description = "Replays the events after Last-Event-ID, then continues live. Streams stay resumable for STREAM_RETENTION after they finish; a generation nobody follows for STREAM_RETENTION is canceled."
+	o.Parameters = []openapi.Parameter{
+		openapi.PathParam("streamId", "x-stream-id of the original response"),
+		{Name: "Last-Event-ID", In: "header", Description: "id of the last event received; omit to replay from the start", Schema: openapi.Schema{"type": "string"}},
+		openapi.QueryParam("lastEventId", "string", "Alternative to the Last-Event-ID header"),
+	}
+	o.Responses["200"] = sse
+	o.Responses["404"] = d.JSONResponse("Unknown or expired stream", handlers.ErrorBody{})
+	o.Responses["410"] = d.JSONResponse("Events after Last-Event-ID are no longer buffered", handlers.ErrorBody{})
+	o.Responses["422"] = d.JSONResponse("Invalid Last-Event-ID", handlers.ErrorBody{})
+	d.Add(http.MethodGet, "/v1/chat/stream/{streamId}", o)
+
+	o = op("cancelChatStream", "Stop a chat stream", "chat", false)
+	o.Description = "Cancels the generation; followers get an error event with code canceled, then done. Finished streams are left unchanged."
+	o.Parameters = []openapi.Parameter{openapi.PathParam("streamId", "x-stream-id of the original response")}
+	o.Responses["204"] = openapi.Response{Description: "Canceled"}
+	o.Responses["404"] = d.JSONResponse("Unknown or expired stream", handlers.ErrorBody{})
+	d.Add(http.MethodDelete, "/v1/chat/stream/{streamId}", o)
+
+	o = op("chatWebSocket", "Chat over a WebSocket", "chat", false)
+	o.Description = "Upgrades to a WebSocket carrying concurrent generations. Send {\"type\":\"chat\",\"id\":\"…\",\"request\":{ChatRequest}} to start one and {\"type\":\"cancel\",\"id\":\"…\"} to stop it. Each stream event arrives as {\"type\":event,\"id\":…,\"data\":payload}; done is always last for an id. Closing the connection cancels its generations."
+	o.Responses["101"] = openapi.Response{Description: "Switching to the WebSocket protocol"}
+	o.Responses["403"] = d.JSONResponse("Origin does not match CORS_ALLOW_ORIGIN", handlers.ErrorBody{})
+	o.Responses["426"] = d.JSONResponse("Not a WebSocket handshake", handlers.ErrorBody{})
+	d.Add(http.MethodGet, "/v1/chat/ws", o)
+
+	o = withBody(op("chatCompletions", "OpenAI-compatible chat completions", "chat", false), handlers.ChatCompletionRequest{})
+	ok := d.JSONResponse("chat.completion, or chat.completion.chunk events when stream is true", handlers.ChatCompletionResponse{})
+	ok.Content["text/event-stream"] = sse.Content["text/event-stream"]
+	o.Responses["200"] = ok
+	d.Add(http.MethodPost, "/v1/chat/completions", o)
+
+	o = withBody(op("createJob", "Start a background chat generation", "jobs", false), handlers.ChatRequest{})
+	o.Description = "Runs the chat request on the service's worker pool, detached from this connection. Poll getJob or attach to jobEvents."
+	o.Responses["202"] = d.JSONResponse("Queued; Location names the job", jobs.Job{})
+	o.Responses["503"] = d.JSONResponse("Job queue is full", handlers.ErrorBody{})
+	d.Add(http.MethodPost, "/v1/jobs", o)
+
+	jobParam := []openapi.Parameter{openapi.PathParam("jobId", "Job id")}
+
+	o = op("getJob", "Get a job's status and result", "jobs", false)
+	o.Parameters = jobParam
+	o.Responses["200"] = d.JSONResponse("Job", jobs.Job{})
+	d.Add(http.MethodGet, "/v1/jobs/{jobId}", o)
+
+	o = op("cancelJob", "Cancel a job", "jobs", false)
+	o.Parameters = jobParam
+	o.Responses["200"] = d.JSONResponse("The job after it stopped; finished jobs are unchanged", jobs.Job{})
+	d.Add(http.MethodDelete, "/v1/jobs/{jobId}", o)
+
+	o = op("jobEvents", "Attach to a job's event stream", "jobs", false)
+	o.Description = "The chatStream event set with numeric ids. Last-Event-ID resumes; finished jobs whose stream has expired replay their stored result."
+	o.Parameters = append(append([]openapi.Parameter{}, jobParam...),
+		openapi.Parameter{Name: "Last-Event-ID", In: "header", Description: "id of the last event received", Schema: openapi.Schema{"type": "string"}},
+		openapi.QueryParam("lastEventId", "string", "Alternative to the Last-Event-ID header"),
+	)
+	o.Responses["200"] = sse
+	o.Responses["410"] = d.JSONResponse("Events after Last-Event-ID are no longer buffered", handlers.ErrorBody{})
+	d.Add(http.MethodGet, "/v1/jobs/{jobId}/events", o)
+
+	o = op("listConversations", "List conversations", "conversations", false)
+	o.Responses["200"] = d.JSONResponse("Conversations", handlers.ConversationList{})
+	d.Add(http.MethodGet, "/v1/conversations", o)
+
+	o = withBody(op("createConversation", "Create a conversation", "conversations", false), handlers.ConversationInput{})
+	o.Responses["201"] = d.JSONResponse("Created", conversations.Conversation{})
+	d.Add(http.MethodPost, "/v1/conversations", o)
+
+	idParam := []openapi.Parameter{openapi.PathParam("conversationId", "Conversation id")}
+
+	o = op("getConversation", "Get a conversation", "conversations", false)
+	o.Parameters = idParam
+	o.Responses["200"] = d.JSONResponse("Conversation", conversations.Conversation{})
+	d.Add(http.MethodGet, "/v1/conversations/{conversationId}", o)
+
+	o = withBody(op("renameConversation", "Rename a conversation", "conversations", false), handlers.ConversationInput{})
+	o.Parameters = idParam
+	o.Responses["200"] = d.JSONResponse("Conversation", conversations.Conversation{})
+	d.Add(http.MethodPatch, "/v1/conversations/{conversationId}", o)
+
+	o = op("deleteConversation", "Delete a conversation", "conversations", false)
+	o.Parameters = idParam
+	o.Responses["204"] = openapi.Response{Description: "Deleted"}
+	d.Add(http.MethodDelete, "/v1/conversations/{conversationId}", o)
+
+	o = withBody(op("appendMessages", "Append messages to a conversation", "conversations", false), handlers.AppendMessagesInput{})
+	o.Parameters = idParam
+	o.Responses["201"] = d.JSONResponse("Conversation", conversations.Conversation{})
+	d.Add(http.MethodPost, "/v1/conversations/{conversationId}/messages", o)
+
+	return d
+}
+
+// specHandler serves the document encoded once at startup.
+func specHandler(d *openapi.Document) http.Handler {
+	body, err := d.JSON()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json; charset=utf-8")
+		_, _ = w.Write(body)
+	})
+}
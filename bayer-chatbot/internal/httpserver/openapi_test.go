@@ -0,0 +1,76 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"bayer-chatbot-service/internal/handlers"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/upstream"
+)
+
+// TestSpecCoversRoutes fails when a route registered by registerRoutes has no
+// operation in the OpenAPI document, or the document describes an operation
+// no route serves.
+func TestSpecCoversRoutes(t *testing.T) {
+	spec := apiSpec(true)
+	h := handlers.New(handlers.Options{Client: upstream.NewClient(upstream.Options{BaseURL: "http://upstream.invalid"})})
+	rt := registerRoutes(h, metrics.NewRegistry(), spec)
+
+	registered := map[string]bool{}
+	for _, r := range rt.routes {
+		registered[r.Method+" "+r.Path] = true
+		if !spec.Has(r.Method, r.Path) {
+			t.Errorf("route %s %s is registered but missing from the OpenAPI spec", r.Method, r.Path)
+			continue
+		}
+		if id := spec.Paths[r.Path][strings.ToLower(r.Method)].OperationID; id != r.Name {
+			t.Errorf("route %s %s is named %q but its operationId is %q", r.Method, r.Path, r.Name, id)
+		}
+	}
+
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if !registered[strings.ToUpper(method)+" "+path] {
+				t.Errorf("spec operation %s %s has no registered route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestSpecIsValidJSON(t *testing.T) {
+	b, err := apiSpec(false).JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi = %q, want 3.1.0", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/metrics"]; ok {
+		t.Error("/metrics described although metrics are disabled")
+	}
+	for _, name := range []string{"ChatRequest", "ChatMessage", "ErrorBody", "ModelList"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s missing from components", name)
+		}
+	}
+
+	// Every $ref must resolve.
+	for _, ref := range strings.Split(string(b), `"$ref": "#/components/schemas/`)[1:] {
+		name := ref[:strings.IndexByte(ref, '"')]
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("dangling $ref to %s", name)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/auth"
+	"bayer-chatbot-service/internal/config"
+	"bayer-chatbot-service/internal/handlers"
+	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/utils"
+)
+
+// bucketLimiter is a set of token buckets keyed by caller or model. A rate of
+// zero disables it.
+type bucketLimiter struct {
+	mu        sync.Mutex
+	rate      float64 // tokens per second
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucketLimiter(rate float64, burst int) *bucketLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &bucketLimiter{rate: rate, burst: float64(burst), buckets: map[string]*tokenBucket{}}
+}
+
+func (l *bucketLimiter) enabled() bool {
+	return l != nil && l.rate > 0
+}
+
+// take consumes one token for key. It returns the tokens left, and when the
+// request is refused, how long until a token is available.
+func (l *bucketLimiter) take(key string, now time.Time) (ok bool, remaining int, retryAfter, reset time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	b, found := l.buckets[key]
+	if !found {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retryAfter = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	reset = time.Duration((l.burst - b.tokens) / l.rate * float64(time.Second))
+	return ok, int(b.tokens), retryAfter, reset
+}
+
+// sweep drops buckets that have refilled completely so idle callers do not
+// accumulate in memory.
+func (l *bucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// concurrencyLimiter caps simultaneous streams per key. A max of zero
+// disables it.
+type concurrencyLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	return &concurrencyLimiter{max: max, active: map[string]int{}}
+}
+
+func (l *concurrencyLimiter) acquire(key string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key] >= l.max {
+		return false
+	}
+	l.active[key]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(key string) {
+	if l.max <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active[key]--
+	if l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+}
+
+// chatPaths take a model or assistant from the body; only they count
+// against the per-model limits.
+var chatPaths = map[string]bool{
+	"/v1/chat":             true,
+	"/v1/chat/stream":      true,
+	"/v1/chat/completions": true,
+	"/v1/jobs":             true,
+}
+
+// streamingPaths always hold a connection open for the generation.
+// /v1/chat/ws is limited per generation instead; see requestLimits.Acquire.
+var streamingPaths = map[string]bool{
+	"/v1/chat/stream": true,
+}
+
+// isStreaming reports whether r holds a stream open, including job events
+// at /v1/jobs/{jobId}/events. Resuming /v1/chat/stream/{streamId} is not
+// counted: the generation keeps its slot until it ends.
+func isStreaming(r *http.Request) bool {
+	p := r.URL.Path
+	return streamingPaths[p] || (strings.HasPrefix(p, "/v1/jobs/") && strings.HasSuffix(p, "/events"))
+}
+
+// requestLimits holds the stream slots taken for one request. They are
+// freed when the handler returns unless it called Hold.
+type requestLimits struct {
+	caller        string
+	callerRate    *bucketLimiter
+	modelRate     *bucketLimiter
+	callerStreams *concurrencyLimiter
+	modelStreams  *concurrencyLimiter
+	rejected      func(scope, model string)
+
+	mu       sync.Mutex
+	releases []func()
+	held     bool
+}
+
+func (l *requestLimits) add(release func()) {
+	l.mu.Lock()
+	l.releases = append(l.releases, release)
+	l.mu.Unlock()
+}
+
+// Hold implements handlers.Limits.
+func (l *requestLimits) Hold() func() {
+	l.mu.Lock()
+	l.held = true
+	l.mu.Unlock()
+	var once sync.Once
+	return func() { once.Do(l.release) }
+}
+
+// done runs when the handler returns.
+func (l *requestLimits) done() {
+	l.mu.Lock()
+	held := l.held
+	l.mu.Unlock()
+	if !held {
+		l.release()
+	}
+}
+
+// Acquire implements handlers.Limits.
+func (l *requestLimits) Acquire(model, assistantID string) (func(), error) {
+	key := chatTarget{Model: model, AssistantID: assistantID}.key()
+	refuse := func(scope string, retryAfter time.Duration) error {
+		l.rejected(scope, key)
+		return &handlers.LimitError{Scope: scope, RetryAfter: retryAfter}
+	}
+
+	now := time.Now()
+	if l.callerRate.enabled() {
+		if ok, _, retryAfter, _ := l.callerRate.take(l.caller, now); !ok {
+			return nil, refuse("caller", retryAfter)
+		}
+	}
+	if key != "" && l.modelRate.enabled() {
+		if ok, _, retryAfter, _ := l.modelRate.take(key, now); !ok {
+			return nil, refuse("model", retryAfter)
+		}
+	}
+	if !l.callerStreams.acquire(l.caller) {
+		return nil, refuse("caller_streams", time.Second)
+	}
+	if key != "" && !l.modelStreams.acquire(key) {
+		l.callerStreams.release(l.caller)
+		return nil, refuse("model_streams", time.Second)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.callerStreams.release(l.caller)
+			if key != "" {
+				l.modelStreams.release(key)
+			}
+		})
+	}, nil
+}
+
+func (l *requestLimits) release() {
+	l.mu.Lock()
+	releases := l.releases
+	l.releases = nil
+	l.mu.Unlock()
+	for _, release := range releases {
+		release()
+	}
+}
+
+// withRateLimit applies per-caller and per-model token buckets to every
+// non-public request, plus per-caller and per-model caps on concurrent
+// streams. Callers are identified by API-key name, or by client IP when
+// unauthenticated.
+func withRateLimit(cfg config.Config, logr *logger.Logger, next http.Handler) http.Handler {
+	callerRate := newBucketLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+	modelRate := newBucketLimiter(cfg.RateLimitModelRPS, cfg.RateLimitModelBurst)
+	callerStreams := newConcurrencyLimiter(cfg.MaxStreamsPerCaller)
+	modelStreams := newConcurrencyLimiter(cfg.MaxStreamsPerModel)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		caller := callerKey(r, cfg.RateLimitTrustForwarded)
+		var target chatTarget
+		if chatPaths[r.URL.Path] {
+			target = peekChatTarget(r)
+		}
+		model := target.key()
+
+		rejected := func(scope, model string) {
+			logr.Ctx(r.Context()).Warn("ratelimit.rejected", map[string]interface{}{
+				"client": caller,
+				"model":  model,
+				"scope":  scope,
+			})
+		}
+		reject := func(scope string, retryAfter time.Duration) {
+			secs := int(math.Ceil(retryAfter.Seconds()))
+			if secs < 1 {
+				secs = 1
+			}
+			w.Header().Set("retry-after", intToString(secs))
+			rejected(scope, model)
+			utils.WriteJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+				"error":     "rate_limited",
+				"message":   "rate limit exceeded (" + scope + ")",
+				"requestId": r.Header.Get("x-request-id"),
+				"retryable": true,
+			})
+		}
+
+		if callerRate.enabled() {
+			ok, remaining, retryAfter, reset := callerRate.take(caller, now)
+			w.Header().Set("x-ratelimit-limit", intToString(int(callerRate.burst)))
+			w.Header().Set("x-ratelimit-remaining", intToString(remaining))
+			w.Header().Set("x-ratelimit-reset", intToString(int(math.Ceil(reset.Seconds()))))
+			if !ok {
+				reject("caller", retryAfter)
+				return
+			}
+		}
+		if model != "" && modelRate.enabled() {
+			if ok, _, retryAfter, _ := modelRate.take(model, now); !ok {
+				reject("model", retryAfter)
+				return
+			}
+		}
+
+		// Handlers may keep the slots past their return; see handlers.Limits.
+		lim := &requestLimits{
+			caller:        caller,
+			callerRate:    callerRate,
+			modelRate:     modelRate,
+			callerStreams: callerStreams,
+			modelStreams:  modelStreams,
+			rejected:      rejected,
+		}
+		defer lim.done()
+		if isStreaming(r) || target.Stream {
+			if !callerStreams.acquire(caller) {
+				reject("caller_streams", time.Second)
+				return
+			}
+			lim.add(func() { callerStreams.release(caller) })
+			if model != "" {
+				if !modelStreams.acquire(model) {
+					reject("model_streams", time.Second)
+					return
+				}
+				lim.add(func() { modelStreams.release(model) })
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(handlers.WithLimits(r.Context(), lim)))
+	})
+}
+
+func callerKey(r *http.Request, trustForwarded bool) string {
+	if id, ok := auth.FromContext(r.Context()); ok {
+		return "caller:" + id.Name
+	}
+	if trustForwarded {
+		if xff := r.Header.Get("x-forwarded-for"); xff != "" {
+			return "ip:" + strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type chatTarget struct {
+	Model       string `json:"model"`
+	AssistantID string `json:"assistant_id"`
+	Stream      bool   `json:"stream"`
+}
+
+func (t chatTarget) key() string {
+	if t.AssistantID != "" {
+		return "assistant:" + t.AssistantID
+	}
+	if t.Model != "" {
+		return "model:" + t.Model
+	}
+	return ""
+}
+
+// peekChatTarget reads model/assistant_id/stream from a JSON request body and
+// restores the body for the handler.
+func peekChatTarget(r *http.Request) chatTarget {
+	var t chatTarget
+	if r.Body == nil || r.Method != http.MethodPost {
+		return t
+	}
+	b, _ := io.ReadAll(io.LimitReader(r.Body, 2<<20))
+	// Anything past the peek limit stays readable for the handler.
+	r.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(b), r.Body), Closer: r.Body}
+	_ = json.Unmarshal(b, &t)
+	return t
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,254 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bayer-chatbot-service/internal/config"
+	"bayer-chatbot-service/internal/handlers"
+)
+
+func TestBucketLimiter(t *testing.T) {
+	type take struct {
+		at         time.Duration
+		ok         bool
+		remaining  int
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		takes []take
+	}{
+		{
+			name: "burst then refill",
+			rate: 2, burst: 3,
+			takes: []take{
+				{at: 0, ok: true, remaining: 2},
+				{at: 0, ok: true, remaining: 1},
+				{at: 0, ok: true, remaining: 0},
+				{at: 0, ok: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{at: 250 * time.Millisecond, ok: false, remaining: 0, retryAfter: 250 * time.Millisecond},
+				{at: 500 * time.Millisecond, ok: true, remaining: 0},
+			},
+		},
+		{
+			name: "refill stops at the burst",
+			rate: 2, burst: 3,
+			takes: []take{
+				{at: 0, ok: true, remaining: 2},
+				{at: time.Hour, ok: true, remaining: 2},
+			},
+		},
+		{
+			name: "burst defaults to the rate",
+			rate: 1.5,
+			takes: []take{
+				{at: 0, ok: true, remaining: 1},
+				{at: 0, ok: true, remaining: 0},
+				{at: 0, ok: false, remaining: 0, retryAfter: 2 * time.Second / 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newBucketLimiter(tt.rate, tt.burst)
+			start := time.Now()
+			for i, want := range tt.takes {
+				ok, remaining, retryAfter, _ := l.take("alice", start.Add(want.at))
+				if ok != want.ok || remaining != want.remaining || retryAfter != want.retryAfter {
+					t.Fatalf("take %d = %v, %d, %v, want %v, %d, %v", i, ok, remaining, retryAfter, want.ok, want.remaining, want.retryAfter)
+				}
+			}
+			// Other keys have their own bucket.
+			if ok, _, _, _ := l.take("bob", start); !ok {
+				t.Error("bob was limited by alice's bucket")
+			}
+		})
+	}
+
+	if newBucketLimiter(0, 5).enabled() {
+		t.Error("a zero rate is enabled")
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := newConcurrencyLimiter(2)
+	if !l.acquire("alice") || !l.acquire("alice") {
+		t.Fatal("refused below the cap")
+	}
+	if l.acquire("alice") {
+		t.Fatal("admitted above the cap")
+	}
+	if !l.acquire("bob") {
+		t.Fatal("bob was limited by alice's streams")
+	}
+	l.release("alice")
+	if !l.acquire("alice") {
+		t.Fatal("refused after a release")
+	}
+	l.release("alice")
+	l.release("alice")
+	l.release("bob")
+	if len(l.active) != 0 {
+		t.Errorf("released keys are kept: %v", l.active)
+	}
+
+	unlimited := newConcurrencyLimiter(0)
+	for i := 0; i < 10; i++ {
+		if !unlimited.acquire("alice") {
+			t.Fatal("a zero cap refused a stream")
+		}
+	}
+}
+
+func TestRequestLimits(t *testing.T) {
+	newLimits := func() (*requestLimits, *concurrencyLimiter) {
+		streams := newConcurrencyLimiter(1)
+		return &requestLimits{
+			caller:        "alice",
+			callerStreams: streams,
+			modelStreams:  newConcurrencyLimiter(0),
+			rejected:      func(string, string) {},
+		}, streams
+	}
+	taken := func(l *requestLimits, streams *concurrencyLimiter) {
+		streams.acquire(l.caller)
+		l.add(func() { streams.release(l.caller) })
+	}
+
+	t.Run("freed when the handler returns", func(t *testing.T) {
+		l, streams := newLimits()
+		taken(l, streams)
+		l.done()
+		if streams.active["alice"] != 0 {
+			t.Error("slot kept after done")
+		}
+	})
+
+	t.Run("held until released", func(t *testing.T) {
+		l, streams := newLimits()
+		taken(l, streams)
+		release := l.Hold()
+		l.done()
+		if streams.active["alice"] != 1 {
+			t.Fatal("held slot freed by done")
+		}
+		release()
+		release()
+		if n := streams.active["alice"]; n != 0 {
+			t.Errorf("%d slots after release, want 0", n)
+		}
+	})
+
+	t.Run("per generation", func(t *testing.T) {
+		l, _ := newLimits()
+		release, err := l.Acquire("gpt-4o", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var limitErr *handlers.LimitError
+		if _, err := l.Acquire("gpt-4o", ""); !errors.As(err, &limitErr) || limitErr.Scope != "caller_streams" {
+			t.Fatalf("second generation = %v, want a caller_streams LimitError", err)
+		}
+		release()
+		release()
+		if _, err := l.Acquire("gpt-4o", ""); err != nil {
+			t.Errorf("generation after release = %v", err)
+		}
+	})
+}
+
+func TestWithRateLimit(t *testing.T) {
+	cfg := config.Config{RateLimitRPS: 0.001, RateLimitBurst: 2}
+	h := withRateLimit(cfg, nil, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		if w.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+		}
+		if got := w.Header().Get("x-ratelimit-limit"); got != "2" {
+			t.Errorf("request %d: x-ratelimit-limit %q", i, got)
+		}
+		if want == http.StatusTooManyRequests && w.Header().Get("retry-after") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("public path limited: %d", w.Code)
+	}
+}
+
+func TestWithRateLimitStreams(t *testing.T) {
+	cfg := config.Config{MaxStreamsPerCaller: 1}
+	entered := make(chan struct{})
+	finish := make(chan struct{})
+	h := withRateLimit(cfg, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-block") != "" {
+			close(entered)
+			<-finish
+		}
+	}))
+	stream := func(block bool) int {
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/stream", strings.NewReader(`{"model":"gpt-4o"}`))
+		if block {
+			r.Header.Set("x-block", "1")
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	first := make(chan int)
+	go func() { first <- stream(true) }()
+	<-entered
+	if code := stream(false); code != http.StatusTooManyRequests {
+		t.Fatalf("second stream: status %d, want 429", code)
+	}
+	close(finish)
+	if code := <-first; code != http.StatusOK {
+		t.Fatalf("first stream: status %d", code)
+	}
+	if code := stream(false); code != http.StatusOK {
+		t.Errorf("stream after the first ended: status %d, want 200", code)
+	}
+}
+
+func TestPeekChatTarget(t *testing.T) {
+	long := `{"model":"gpt-4o","stream":true,"pad":"` + strings.Repeat("x", 3<<20) + `"}`
+	tests := []struct {
+		name string
+		body string
+		want chatTarget
+	}{
+		{"model", `{"model":"gpt-4o","stream":true}`, chatTarget{Model: "gpt-4o", Stream: true}},
+		{"assistant", `{"assistant_id":"a1","model":"gpt-4o"}`, chatTarget{Model: "gpt-4o", AssistantID: "a1"}},
+		{"not json", `model=gpt-4o`, chatTarget{}},
+		// Past the peek limit nothing is parsed, but the handler still
+		// reads the whole body.
+		{"beyond the peek limit", long, chatTarget{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat", strings.NewReader(tt.body))
+			if got := peekChatTarget(r); got != tt.want {
+				t.Errorf("target = %+v, want %+v", got, tt.want)
+			}
+			b, err := io.ReadAll(r.Body)
+			if err != nil || string(b) != tt.body {
+				t.Errorf("handler read %d bytes (%v), want the %d-byte body", len(b), err, len(tt.body))
+			}
+		})
+	}
+}
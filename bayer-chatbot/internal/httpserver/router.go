@@ -0,0 +1,116 @@
+package httpserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+// route is one registered method and path. Name labels the route in
+// metrics, logs and spans, and matches the OpenAPI operationId.
+type route struct {
+	Method string
+	Path   string
+	Name   string
+}
+
+// unmatchedRoute names requests no route serves.
+const unmatchedRoute = "unmatched"
+
+// router registers handlers per method on a Go 1.22 ServeMux. Unknown paths
+// get a JSON 404 and known paths with the wrong method a JSON 405 with an
+// Allow header.
+type router struct {
+	mux    *http.ServeMux
+	routes []route
+	byKey  map[string]route
+
+	// paths holds each path once without a method, to tell a 405 from a 404.
+	paths   *http.ServeMux
+	methods map[string][]string
+}
+
+func newRouter() *router {
+	rt := &router{
+		mux:     http.NewServeMux(),
+		byKey:   map[string]route{},
+		paths:   http.NewServeMux(),
+		methods: map[string][]string{},
+	}
+	rt.mux.HandleFunc("/", rt.fallback)
+	return rt
+}
+
+// handle registers h for method and path, e.g. ("GET", "/v1/models"). Path
+// parameters use ServeMux syntax: "/v1/assistants/{assistantId}/users".
+func (rt *router) handle(method, path, name string, h http.HandlerFunc) {
+	rt.mux.Handle(method+" "+path, h)
+	r := route{Method: method, Path: path, Name: name}
+	rt.routes = append(rt.routes, r)
+	rt.byKey[method+" "+path] = r
+	if method == http.MethodGet {
+		// ServeMux serves HEAD with GET handlers.
+		rt.byKey[http.MethodHead+" "+path] = r
+	}
+
+	if _, ok := rt.methods[path]; !ok {
+		rt.paths.Handle(path, http.NotFoundHandler())
+	}
+	rt.methods[path] = append(rt.methods[path], method)
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// lookup returns the route that will serve r, or false when none does.
+func (rt *router) lookup(r *http.Request) (route, bool) {
+	_, pattern := rt.mux.Handler(r)
+	rte, ok := rt.byKey[pattern]
+	return rte, ok
+}
+
+// name labels r for metrics and logs.
+func (rt *router) name(r *http.Request) string {
+	if rte, ok := rt.lookup(r); ok {
+		return rte.Name
+	}
+	return unmatchedRoute
+}
+
+// fallback answers requests no method pattern matched.
+func (rt *router) fallback(w http.ResponseWriter, r *http.Request) {
+	if _, path := rt.paths.Handler(r); path != "" {
+		w.Header().Set("allow", strings.Join(rt.allowed(path), ", "))
+		writeJSONError(w, r, http.StatusMethodNotAllowed, "method_not_allowed", r.Method+" is not allowed on "+r.URL.Path)
+		return
+	}
+	writeJSONError(w, r, http.StatusNotFound, "not_found", "no route for "+r.URL.Path)
+}
+
+func (rt *router) allowed(path string) []string {
+	seen := map[string]bool{http.MethodOptions: true}
+	for _, m := range rt.methods[path] {
+		seen[m] = true
+		if m == http.MethodGet {
+			seen[http.MethodHead] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for m := range seen {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// writeJSONError writes the service error envelope from middleware.
+func writeJSONError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	utils.WriteJSON(w, status, map[string]interface{}{
+		"error":     code,
+		"message":   message,
+		"requestId": r.Header.Get("x-request-id"),
+	})
+}
@@ -1,39 +1,128 @@
 package httpserver
 
 import (
+	"context"
 	"net/http"
 
+	"bayer-chatbot-service/internal/auth"
 	"bayer-chatbot-service/internal/config"
+	"bayer-chatbot-service/internal/conversations"
 	"bayer-chatbot-service/internal/handlers"
+	"bayer-chatbot-service/internal/jobs"
 	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/openapi"
+	"bayer-chatbot-service/internal/tracing"
 	"bayer-chatbot-service/internal/upstream"
 )
 
 type Options struct {
-	Config config.Config
-	Logger *logger.Logger
-	Client *upstream.Client
+	Config        config.Config
+	Logger        *logger.Logger
+	Client        *upstream.Client
+	Conversations conversations.Store
+	// Jobs runs /v1/jobs generations; the routes answer 501 when nil.
+	Jobs *jobs.Manager
+	// Keys enables API-key authentication when non-empty.
+	Keys *auth.KeyStore
+	// CallerTokens maps caller names to their own upstream tokens.
+	CallerTokens map[string]string
+	// Metrics is served at /metrics and shared with the handlers.
+	Metrics *metrics.Registry
+	// Tracer records inbound, upstream and stream spans.
+	Tracer *tracing.Tracer
 }
 
-func New(opts Options) http.Handler {
-	mux := http.NewServeMux()
+// Server is the service's HTTP handler.
+type Server struct {
+	http.Handler
+	h *handlers.Handler
+}
+
+// DrainWebSockets stops /v1/chat/ws connections from starting generations
+// and closes them once their running ones are done. Register it with
+// http.Server.RegisterOnShutdown: Shutdown does not track hijacked
+// connections.
+func (s *Server) DrainWebSockets() {
+	s.h.DrainWebSockets()
+}
 
+// WaitWebSockets waits until every /v1/chat/ws connection has closed, or
+// ctx is done.
+func (s *Server) WaitWebSockets(ctx context.Context) error {
+	return s.h.WaitWebSockets(ctx)
+}
+
+func New(opts Options) *Server {
 	h := handlers.New(handlers.Options{
-		Config: opts.Config,
-		Logger: opts.Logger,
-		Client: opts.Client,
+		Config:        opts.Config,
+		Logger:        opts.Logger.Named("handlers"),
+		Client:        opts.Client,
+		Conversations: opts.Conversations,
+		Jobs:          opts.Jobs,
+		Metrics:       opts.Metrics,
+		Tracer:        opts.Tracer,
 	})
 
-	mux.HandleFunc("/health", h.Health)
-	mux.HandleFunc("/v1/models", h.Models)
-	mux.HandleFunc("/v1/assistants/", h.AssistantUsers) // /v1/assistants/:assistantId/users
-	mux.HandleFunc("/v1/chat", h.Chat)
-	mux.HandleFunc("/v1/chat/stream", h.ChatStream)
+	rt := registerRoutes(h, opts.Metrics, apiSpec(opts.Metrics != nil))
+	logr := opts.Logger.Named("http")
 
-	var handler http.Handler = mux
+	var handler http.Handler = rt
+	handler = withUpstreamAttempts(handler)
+	handler = withCallerToken(opts.CallerTokens, handler)
+	handler = withRateLimit(opts.Config, logr, handler)
+	handler = withAuth(opts.Keys, logr, handler)
 	handler = withCORS(opts.Config, handler)
+	handler = withTracing(opts.Tracer, rt, handler)
+	handler = withHTTPLogging(opts.Config, logr, newHTTPMetrics(opts.Metrics, rt.name), handler)
 	handler = withRequestID(handler)
-	handler = withHTTPLogging(opts.Config, opts.Logger, handler)
 
-	return handler
+	return &Server{Handler: handler, h: h}
+}
+
+// registerRoutes builds the router. Every route must be described by
+// apiSpec under the same method, path and operationId.
+func registerRoutes(h *handlers.Handler, reg *metrics.Registry, spec *openapi.Document) *router {
+	rt := newRouter()
+
+	rt.handle(http.MethodGet, "/health", "health", h.Health)
+	rt.handle(http.MethodGet, "/livez", "livez", h.Livez)
+	rt.handle(http.MethodGet, "/readyz", "readyz", h.Readyz)
+	if reg != nil {
+		rt.handle(http.MethodGet, "/metrics", "metrics", reg.Handler().ServeHTTP)
+	}
+	rt.handle(http.MethodGet, "/openapi.json", "openapi", specHandler(spec).ServeHTTP)
+
+	rt.handle(http.MethodGet, "/v1/models", "listModels", h.Models)
+	rt.handle(http.MethodGet, "/v1/tools", "listTools", h.ListTools)
+
+	rt.handle(http.MethodGet, "/v1/assistants", "listAssistants", h.ListAssistants)
+	rt.handle(http.MethodPost, "/v1/assistants", "createAssistant", h.CreateAssistant)
+	rt.handle(http.MethodGet, "/v1/assistants/{assistantId}", "getAssistant", h.GetAssistant)
+	rt.handle(http.MethodPatch, "/v1/assistants/{assistantId}", "updateAssistant", h.UpdateAssistant)
+	rt.handle(http.MethodDelete, "/v1/assistants/{assistantId}", "deleteAssistant", h.DeleteAssistant)
+	rt.handle(http.MethodGet, "/v1/assistants/{assistantId}/users", "listAssistantUsers", h.AssistantUsers)
+	rt.handle(http.MethodPost, "/v1/assistants/{assistantId}/users", "addAssistantUser", h.AddAssistantUser)
+	rt.handle(http.MethodDelete, "/v1/assistants/{assistantId}/users/{userId}", "removeAssistantUser", h.RemoveAssistantUser)
+
+	rt.handle(http.MethodPost, "/v1/chat", "chat", h.Chat)
+	rt.handle(http.MethodPost, "/v1/chat/stream", "chatStream", h.ChatStream)
+	rt.handle(http.MethodGet, "/v1/chat/stream/{streamId}", "resumeChatStream", h.ResumeChatStream)
+	rt.handle(http.MethodDelete, "/v1/chat/stream/{streamId}", "cancelChatStream", h.CancelChatStream)
+	rt.handle(http.MethodGet, "/v1/chat/ws", "chatWebSocket", h.ChatWebSocket)
+	rt.handle(http.MethodPost, "/v1/chat/completions", "chatCompletions", h.ChatCompletions) // OpenAI-compatible
+
+	rt.handle(http.MethodPost, "/v1/jobs", "createJob", h.CreateJob)
+	rt.handle(http.MethodGet, "/v1/jobs/{jobId}", "getJob", h.GetJob)
+	rt.handle(http.MethodDelete, "/v1/jobs/{jobId}", "cancelJob", h.CancelJob)
+	rt.handle(http.MethodGet, "/v1/jobs/{jobId}/events", "jobEvents", h.JobEvents)
+
+	rt.handle(http.MethodGet, "/v1/conversations", "listConversations", h.ListConversations)
+	rt.handle(http.MethodPost, "/v1/conversations", "createConversation", h.CreateConversation)
+	rt.handle(http.MethodGet, "/v1/conversations/{conversationId}", "getConversation", h.GetConversation)
+	rt.handle(http.MethodPatch, "/v1/conversations/{conversationId}", "renameConversation", h.RenameConversation)
+	rt.handle(http.MethodDelete, "/v1/conversations/{conversationId}", "deleteConversation", h.DeleteConversation)
+	rt.handle(http.MethodPost, "/v1/conversations/{conversationId}/messages", "appendMessages", h.AppendMessages)
+
+	return rt
 }
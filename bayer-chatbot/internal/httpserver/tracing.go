@@ -0,0 +1,48 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/tracing"
+)
+
+// withTracing continues the caller's W3C trace (traceparent/tracestate) or
+// starts a new one, and records a server span for the request. The trace id
+// is added to the request-scoped logger.
+func withTracing(tracer *tracing.Tracer, rt *router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithRemote(ctx, sc)
+		}
+
+		rte, matched := rt.lookup(r)
+		name := r.Method
+		if matched {
+			name += " " + rte.Path
+		}
+		ctx, span := tracer.Start(ctx, name, tracing.KindServer)
+		if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+			if l := logger.FromContext(ctx); l != nil {
+				ctx = logger.WithContext(ctx, l.With(map[string]interface{}{"traceId": sc.TraceIDString()}))
+			}
+		}
+
+		rw := &statusCapturingResponseWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(rw, r.WithContext(ctx))
+
+		span.SetAttribute("http.request.method", r.Method)
+		if matched {
+			span.SetAttribute("http.route", rte.Path)
+			span.SetAttribute("route.name", rte.Name)
+		}
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("http.response.status_code", rw.status)
+		span.SetAttribute("request.id", r.Header.Get("x-request-id"))
+		if rw.status >= 500 {
+			span.SetError(http.StatusText(rw.status))
+		}
+		span.End()
+	})
+}
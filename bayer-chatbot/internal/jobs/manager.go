@@ -0,0 +1,421 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/sse"
+	"bayer-chatbot-service/internal/streams"
+)
+
+var (
+	// ErrQueueFull is returned by Submit when every worker is busy and the
+	// queue is at capacity.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed is returned by Submit after Shutdown.
+	ErrClosed = errors.New("job manager is shutting down")
+
+	errCanceled = errors.New("canceled by the caller")
+	errShutdown = errors.New("the service shut down before the job finished")
+)
+
+// Func runs one job. It appends normalized events to s as they arrive and
+// returns the aggregate of what it appended. ctx is canceled when the job is
+// canceled or the service shuts down.
+type Func func(ctx context.Context, s *streams.Stream) *sse.Aggregate
+
+type Options struct {
+	Store Store
+	// Workers is how many jobs run at once. Default 4.
+	Workers int
+	// QueueSize is how many jobs may wait for a worker. Default 64.
+	QueueSize int
+	// MaxEvents and Retention configure the event streams callers attach
+	// to; see streams.Options.
+	MaxEvents int
+	Retention time.Duration
+	// Expire is how long a finished job is kept. Older jobs read as not
+	// found and are deleted from the Store. Zero keeps jobs forever.
+	Expire  time.Duration
+	Logger  *logger.Logger
+	Metrics *metrics.Registry
+}
+
+// Manager owns the worker pool. Jobs run with the values of the context
+// passed to Submit but not its cancellation; since a job outlives the
+// request that submitted it, callers pass a context that carries only what
+// the job needs rather than the request's own.
+type Manager struct {
+	store   Store
+	logr    *logger.Logger
+	events  *streams.Registry
+	metrics *jobMetrics
+	queue   chan *task
+	wg      sync.WaitGroup
+	expire  time.Duration
+	stop    chan struct{} // closed by Shutdown; ends the sweeper
+
+	mu     sync.Mutex
+	live   map[string]*task
+	closed bool
+}
+
+type task struct {
+	job    Job // guarded by Manager.mu
+	run    Func
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	stream *streams.Stream
+	done   chan struct{}
+}
+
+func NewManager(opts Options) *Manager {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	m := &Manager{
+		store:   opts.Store,
+		logr:    opts.Logger,
+		events:  streams.NewRegistry(streams.Options{MaxEvents: opts.MaxEvents, Retention: opts.Retention}),
+		metrics: newJobMetrics(opts.Metrics),
+		queue:   make(chan *task, opts.QueueSize),
+		expire:  opts.Expire,
+		stop:    make(chan struct{}),
+		live:    map[string]*task{},
+	}
+	m.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go m.work()
+	}
+	if m.expire > 0 {
+		go m.sweep()
+	}
+	return m
+}
+
+// Submit queues run for owner and returns the queued job. ctx supplies the
+// job's context values; see Manager.
+func (m *Manager) Submit(ctx context.Context, owner string, run Func) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	// Only workers drain the queue, so a free slot stays free while we
+	// hold the lock.
+	if len(m.queue) == cap(m.queue) {
+		return Job{}, ErrQueueFull
+	}
+
+	j := Job{ID: newID(), Owner: owner, Status: StatusQueued, CreatedAt: time.Now().UTC()}
+	if err := m.store.Save(ctx, j); err != nil {
+		return Job{}, err
+	}
+	jctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	// The events registry has no MaxStreams, so this cannot fail.
+	stream, _ := m.events.CreateWithID(j.ID, owner, nil)
+	t := &task{
+		job:    j,
+		run:    run,
+		ctx:    jctx,
+		cancel: cancel,
+		stream: stream,
+		done:   make(chan struct{}),
+	}
+	m.live[j.ID] = t
+	m.queue <- t
+	m.metrics.move("", StatusQueued)
+	return j, nil
+}
+
+// Get returns the job with id if it belongs to owner. A job the store holds
+// as unfinished but that no worker knows about was cut off by a restart and
+// is reported, and saved, as failed.
+func (m *Manager) Get(ctx context.Context, id, owner string) (Job, error) {
+	m.mu.Lock()
+	if t, ok := m.live[id]; ok {
+		j := t.job
+		m.mu.Unlock()
+		if j.Owner != owner {
+			return Job{}, ErrNotFound
+		}
+		return j, nil
+	}
+	m.mu.Unlock()
+
+	j, err := m.store.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if j.Owner != owner {
+		return Job{}, ErrNotFound
+	}
+	if m.expired(j, time.Now()) {
+		m.remove(ctx, id)
+		return Job{}, ErrNotFound
+	}
+	if !j.Final() {
+		now := time.Now().UTC()
+		j.Status = StatusFailed
+		j.FinishedAt = &now
+		j.Error = &sse.ErrorPayload{Code: "interrupted", Message: "the service restarted before the job finished"}
+		if err := m.store.Save(ctx, j); err != nil {
+			m.logr.Ctx(ctx).Warn("jobs.save_error", map[string]interface{}{"jobId": id, "error": err.Error()})
+		}
+	}
+	return j, nil
+}
+
+// Events returns the live or recently finished event stream of a job. When
+// the stream has expired, callers replay the stored result instead.
+func (m *Manager) Events(id, owner string) (*streams.Stream, error) {
+	return m.events.Get(id, owner)
+}
+
+// Cancel stops a queued or running job and waits, until ctx is done, for it
+// to settle. Finished jobs are returned unchanged.
+func (m *Manager) Cancel(ctx context.Context, id, owner string) (Job, error) {
+	m.mu.Lock()
+	t, ok := m.live[id]
+	if !ok || t.job.Owner != owner {
+		m.mu.Unlock()
+		return m.Get(ctx, id, owner)
+	}
+	queued := t.job.Status == StatusQueued
+	t.cancel(errCanceled)
+	if queued {
+		// The worker that dequeues it will skip it.
+		m.finishLocked(t, nil)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return t.job, nil
+}
+
+// Shutdown stops accepting jobs and lets queued and running jobs finish
+// until ctx is done; the rest are canceled.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+		close(m.stop)
+	}
+	m.mu.Unlock()
+
+	idle := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	for _, t := range m.live {
+		t.cancel(errShutdown)
+	}
+	m.mu.Unlock()
+	<-idle
+	return ctx.Err()
+}
+
+// expired reports whether j, which no worker holds, finished more than
+// Expire ago. Jobs cut off by a restart count from their creation.
+func (m *Manager) expired(j Job, now time.Time) bool {
+	if m.expire <= 0 {
+		return false
+	}
+	at := j.CreatedAt
+	if j.FinishedAt != nil {
+		at = *j.FinishedAt
+	}
+	return now.Sub(at) > m.expire
+}
+
+func (m *Manager) remove(ctx context.Context, id string) {
+	m.events.Remove(id)
+	if err := m.store.Delete(ctx, id); err != nil && !errors.Is(err, ErrNotFound) {
+		m.logr.Ctx(ctx).Warn("jobs.delete_error", map[string]interface{}{"jobId": id, "error": err.Error()})
+	}
+}
+
+// sweep deletes expired jobs from the store, at start and then every Expire
+// or hour, whichever is shorter, until Shutdown.
+func (m *Manager) sweep() {
+	every := m.expire
+	if every > time.Hour {
+		every = time.Hour
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		m.prune(context.Background())
+		select {
+		case <-ticker.C:
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Manager) prune(ctx context.Context) {
+	all, err := m.store.List(ctx)
+	if err != nil {
+		m.logr.Warn("jobs.list_error", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	removed := 0
+	for _, j := range all {
+		m.mu.Lock()
+		if _, live := m.live[j.ID]; live {
+			m.mu.Unlock()
+			continue
+		}
+		if !j.Final() {
+			// It may have finished since List.
+			if j, err = m.store.Get(ctx, j.ID); err != nil {
+				m.mu.Unlock()
+				continue
+			}
+		}
+		if m.expired(j, now) {
+			m.remove(ctx, j.ID)
+			removed++
+		}
+		m.mu.Unlock()
+	}
+	if removed > 0 {
+		m.logr.Info("jobs.pruned", map[string]interface{}{"count": removed})
+	}
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for t := range m.queue {
+		m.execute(t)
+	}
+}
+
+func (m *Manager) execute(t *task) {
+	m.mu.Lock()
+	if t.job.Final() {
+		m.mu.Unlock()
+		return
+	}
+	if t.ctx.Err() != nil {
+		m.finishLocked(t, nil)
+		m.mu.Unlock()
+		return
+	}
+	now := time.Now().UTC()
+	t.job.Status = StatusRunning
+	t.job.StartedAt = &now
+	m.saveLocked(t.job)
+	m.metrics.move(StatusQueued, StatusRunning)
+	m.mu.Unlock()
+
+	res := t.run(t.ctx, t.stream)
+
+	m.mu.Lock()
+	m.finishLocked(t, res)
+	m.mu.Unlock()
+}
+
+// finishLocked records the outcome of t, closes its stream and releases it.
+func (m *Manager) finishLocked(t *task, res *sse.Aggregate) {
+	from := t.job.Status
+	now := time.Now().UTC()
+	t.job.FinishedAt = &now
+	t.job.Result = res
+	switch {
+	case res != nil && res.Error == nil && res.Done():
+		// Completed before a late cancel took effect.
+		t.job.Status = StatusSucceeded
+	case t.ctx.Err() != nil:
+		t.job.Status = StatusCanceled
+		t.job.Error = &sse.ErrorPayload{Code: "canceled", Message: context.Cause(t.ctx).Error()}
+	case res == nil:
+		t.job.Status = StatusFailed
+		t.job.Error = &sse.ErrorPayload{Code: "internal_error", Message: "job produced no result"}
+	default:
+		t.job.Status = StatusFailed
+		t.job.Error = res.Error
+		if t.job.Error == nil {
+			t.job.Error = &sse.ErrorPayload{Code: "stream_interrupted", Message: "the stream ended without a done event"}
+		}
+	}
+	m.saveLocked(t.job)
+	m.metrics.finish(from, t.job.Status)
+
+	t.cancel(nil)
+	t.stream.Close()
+	if res == nil {
+		// Nothing was streamed; callers attaching later get the stored
+		// outcome instead of an empty stream.
+		m.events.Remove(t.job.ID)
+	}
+	delete(m.live, t.job.ID)
+	close(t.done)
+}
+
+func (m *Manager) saveLocked(j Job) {
+	if err := m.store.Save(context.Background(), j); err != nil {
+		m.logr.Error("jobs.save_error", map[string]interface{}{"jobId": j.ID, "status": j.Status, "error": err.Error()})
+	}
+}
+
+type jobMetrics struct {
+	current  *metrics.GaugeVec
+	finished *metrics.CounterVec
+}
+
+func newJobMetrics(reg *metrics.Registry) *jobMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &jobMetrics{
+		current:  reg.Gauge("jobs", "Background jobs by state.", "status"),
+		finished: reg.Counter("jobs_finished_total", "Background jobs that stopped, by final state.", "status"),
+	}
+}
+
+// move shifts one job between the queued and running gauges; an empty from
+// is a new job.
+func (m *jobMetrics) move(from, to string) {
+	if m == nil {
+		return
+	}
+	if from != "" {
+		m.current.Dec(from)
+	}
+	m.current.Inc(to)
+}
+
+func (m *jobMetrics) finish(from, status string) {
+	if m == nil {
+		return
+	}
+	m.current.Dec(from)
+	m.finished.Inc(status)
+}
@@ -0,0 +1,80 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpiredJobs(t *testing.T) {
+	now := time.Now().UTC()
+	old := now.Add(-2 * time.Hour)
+	recent := now.Add(-time.Minute)
+	tests := []struct {
+		name string
+		job  Job
+		gone bool
+	}{
+		{"finished long ago", Job{Status: StatusSucceeded, CreatedAt: old, FinishedAt: &old}, true},
+		{"finished recently", Job{Status: StatusFailed, CreatedAt: old, FinishedAt: &recent}, false},
+		{"cut off by a restart long ago", Job{Status: StatusRunning, CreatedAt: old}, true},
+		{"cut off by a restart recently", Job{Status: StatusQueued, CreatedAt: recent}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := map[string]Store{"memory": NewMemoryStore()}
+			fs, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			stores["file"] = fs
+
+			for kind, store := range stores {
+				j := tt.job
+				j.ID, j.Owner = newID(), "alice"
+				if err := store.Save(context.Background(), j); err != nil {
+					t.Fatal(err)
+				}
+				m := NewManager(Options{Store: store, Expire: time.Hour})
+				_ = m.Shutdown(context.Background())
+
+				_, err := m.Get(context.Background(), j.ID, "alice")
+				if gone := errors.Is(err, ErrNotFound); gone != tt.gone {
+					t.Errorf("%s: Get error = %v, want gone %v", kind, err, tt.gone)
+				}
+				if _, err := store.Get(context.Background(), j.ID); errors.Is(err, ErrNotFound) != tt.gone {
+					t.Errorf("%s: stored job deleted = %v, want %v", kind, !tt.gone, tt.gone)
+				}
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := NewMemoryStore()
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	expired := Job{ID: newID(), Status: StatusCanceled, CreatedAt: old, FinishedAt: &old}
+	kept := Job{ID: newID(), Status: StatusSucceeded, CreatedAt: time.Now().UTC()}
+	kept.FinishedAt = &kept.CreatedAt
+	for _, j := range []Job{expired, kept} {
+		_ = store.Save(context.Background(), j)
+	}
+
+	// NewManager prunes once right away.
+	m := NewManager(Options{Store: store, Expire: time.Hour})
+	defer m.Shutdown(context.Background())
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := store.Get(context.Background(), expired.ID); errors.Is(err, ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expired job was not pruned")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := store.Get(context.Background(), kept.ID); err != nil {
+		t.Errorf("recent job was pruned: %v", err)
+	}
+}
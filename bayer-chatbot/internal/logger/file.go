@@ -0,0 +1,142 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileOptions configure a rotating file sink. Zero values disable the
+// corresponding limit.
+type FileOptions struct {
+	Path string
+	// MaxSize rotates the file once it would grow past this many bytes.
+	MaxSize int64
+	// MaxAge rotates the file once it has been open this long.
+	MaxAge time.Duration
+	// MaxBackups is how many rotated files to keep.
+	MaxBackups int
+	// Retention deletes rotated files older than this.
+	Retention time.Duration
+}
+
+// FileSink appends lines to a file and rotates it by size and age. Rotated
+// files are renamed to "<path>.<timestamp>".
+type FileSink struct {
+	opts   FileOptions
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+const rotateStamp = "20060102T150405.000"
+
+func NewFileSink(opts FileOptions) (*FileSink, error) {
+	if dir := filepath.Dir(opts.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, err
+		}
+	}
+	s := &FileSink{opts: opts}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.f = f
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+func (s *FileSink) WriteLog(_ Level, line []byte) error {
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	n := int64(len(line) + 1)
+	if s.needsRotation(n) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	written, err := s.f.Write(append(line, '\n'))
+	s.size += int64(written)
+	return err
+}
+
+func (s *FileSink) needsRotation(next int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.MaxSize > 0 && s.size+next > s.opts.MaxSize {
+		return true
+	}
+	return s.opts.MaxAge > 0 && time.Since(s.opened) >= s.opts.MaxAge
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	backup := s.opts.Path + "." + time.Now().UTC().Format(rotateStamp)
+	if err := os.Rename(s.opts.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.prune()
+	return nil
+}
+
+// prune enforces MaxBackups and Retention on rotated files.
+func (s *FileSink) prune() {
+	matches, err := filepath.Glob(s.opts.Path + ".*")
+	if err != nil {
+		return
+	}
+	backups := matches[:0]
+	prefix := s.opts.Path + "."
+	for _, m := range matches {
+		if _, err := time.Parse(rotateStamp, strings.TrimPrefix(m, prefix)); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	// The timestamp suffix sorts chronologically; newest last.
+	sort.Strings(backups)
+
+	now := time.Now()
+	for i, b := range backups {
+		expired := s.opts.MaxBackups > 0 && i < len(backups)-s.opts.MaxBackups
+		if !expired && s.opts.Retention > 0 {
+			if info, err := os.Stat(b); err == nil && now.Sub(info.ModTime()) > s.opts.Retention {
+				expired = true
+			}
+		}
+		if expired {
+			_ = os.Remove(b)
+		}
+	}
+}
+
+func (s *FileSink) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
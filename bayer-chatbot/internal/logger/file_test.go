@@ -0,0 +1,187 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backups lists rotated files of path, oldest first.
+func backups(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".2*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+// writeLines writes each line, pausing so rotated names do not collide.
+func writeLines(t *testing.T, s *FileSink, lines ...string) {
+	t.Helper()
+	for _, l := range lines {
+		if err := s.WriteLog(LevelInfo, []byte(l)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        FileOptions
+		lines       []string
+		wantBackups int
+		wantCurrent string
+	}{
+		{
+			name:        "no limits",
+			lines:       []string{"one", "two", "three"},
+			wantCurrent: "one\ntwo\nthree\n",
+		},
+		{
+			name:        "by size",
+			opts:        FileOptions{MaxSize: 8},
+			lines:       []string{"aaaa", "bbbb", "cccc"},
+			wantBackups: 2,
+			wantCurrent: "cccc\n",
+		},
+		{
+			name:        "fits under size",
+			opts:        FileOptions{MaxSize: 10},
+			lines:       []string{"aaaa", "bbbb", "cccc"},
+			wantBackups: 1,
+			wantCurrent: "cccc\n",
+		},
+		{
+			name:        "max backups",
+			opts:        FileOptions{MaxSize: 1, MaxBackups: 2},
+			lines:       []string{"a", "b", "c", "d", "e"},
+			wantBackups: 2,
+			wantCurrent: "e\n",
+		},
+		{
+			name:        "oversized first line is written",
+			opts:        FileOptions{MaxSize: 2},
+			lines:       []string{"longer than the limit"},
+			wantCurrent: "longer than the limit\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Path = filepath.Join(t.TempDir(), "logs", "svc.log")
+			s, err := NewFileSink(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			writeLines(t, s, tt.lines...)
+
+			if got := len(backups(t, tt.opts.Path)); got != tt.wantBackups {
+				t.Errorf("%d backups, want %d", got, tt.wantBackups)
+			}
+			b, err := os.ReadFile(tt.opts.Path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.wantCurrent {
+				t.Errorf("current file = %q, want %q", b, tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestFileSinkKeepsNewestBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	s, err := NewFileSink(FileOptions{Path: path, MaxSize: 1, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	writeLines(t, s, "a", "b", "c", "d")
+
+	var kept []string
+	for _, b := range backups(t, path) {
+		data, _ := os.ReadFile(b)
+		kept = append(kept, strings.TrimSpace(string(data)))
+	}
+	if strings.Join(kept, ",") != "b,c" {
+		t.Errorf("kept backups %v, want [b c]", kept)
+	}
+}
+
+func TestFileSinkRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "svc.log")
+	s, err := NewFileSink(FileOptions{Path: path, MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	writeLines(t, s, "old")
+	s.opened = time.Now().Add(-2 * time.Hour)
+	writeLines(t, s, "new")
+
+	if got := len(backups(t, path)); got != 1 {
+		t.Errorf("%d backups, want 1", got)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "new\n" {
+		t.Errorf("current file = %q, want %q", b, "new\n")
+	}
+}
+
+func TestFileSinkRetention(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc.log")
+
+	// A stale backup from an earlier run, and files that only look similar.
+	stale := path + "." + time.Now().Add(-48*time.Hour).UTC().Format(rotateStamp)
+	unrelated := path + ".keep"
+	for _, f := range []string{stale, unrelated} {
+		if err := os.WriteFile(f, []byte("x\n"), 0o640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(unrelated, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewFileSink(FileOptions{Path: path, MaxSize: 1, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	writeLines(t, s, "a", "b")
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("backup older than Retention was kept")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Errorf("file without a rotation stamp was removed: %v", err)
+	}
+	if got := len(backups(t, path)); got != 1 {
+		t.Errorf("%d backups, want the fresh one", got)
+	}
+}
+
+func TestFileSinkClosed(t *testing.T) {
+	s, err := NewFileSink(FileOptions{Path: filepath.Join(t.TempDir(), "svc.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("second Close = %v, want nil", err)
+	}
+	if err := s.WriteLog(LevelInfo, []byte("late")); err == nil {
+		t.Error("WriteLog after Close succeeded")
+	}
+}
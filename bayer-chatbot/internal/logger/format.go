@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	formatJSON    = "json"
+	formatConsole = "console"
+)
+
+// encode renders one line, without the trailing newline.
+func (c *core) encode(ts time.Time, level Level, msg string, fields map[string]interface{}) ([]byte, error) {
+	if c.format == formatConsole {
+		return encodeConsole(ts, level, msg, fields), nil
+	}
+
+	payload := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		payload[k] = v
+	}
+	payload["ts"] = ts.Format(time.RFC3339Nano)
+	payload["level"] = level.String()
+	payload["msg"] = msg
+	return json.Marshal(payload)
+}
+
+// encodeConsole renders a line for humans:
+//
+//	15:04:05.000 WARN  upstream.retry  attempt=1 status=503 url=http://…
+func encodeConsole(ts time.Time, level Level, msg string, fields map[string]interface{}) []byte {
+	var b strings.Builder
+	b.WriteString(ts.Local().Format("15:04:05.000"))
+	b.WriteByte(' ')
+	b.WriteString(fmt.Sprintf("%-5s", strings.ToUpper(level.String())))
+	b.WriteByte(' ')
+	if comp, ok := fields["component"].(string); ok && comp != "" {
+		b.WriteString("[" + comp + "] ")
+	}
+	b.WriteString(msg)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if k != "component" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString("  " + k + "=" + consoleValue(fields[k]))
+	}
+	return []byte(b.String())
+}
+
+func consoleValue(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case nil:
+		return "null"
+	case bool, int, int64, float64:
+		return fmt.Sprint(x)
+	default:
+		raw, err := json.Marshal(x)
+		if err != nil {
+			return fmt.Sprint(x)
+		}
+		return string(raw)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -1,9 +1,9 @@
 package logger
 
 import (
-	"encoding/json"
-	"os"
+	"context"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,13 +17,89 @@ const (
 	LevelDebug
 )
 
+func (l Level) String() string {
+	switch l {
+	case LevelError:
+		return "error"
+	case LevelWarn:
+		return "warn"
+	case LevelInfo:
+		return "info"
+	case LevelDebug:
+		return "debug"
+	}
+	return "silent"
+}
+
+// Options configure a Logger built with NewWithOptions.
+type Options struct {
+	// Level is a default level optionally followed by per-component
+	// overrides, e.g. "info,upstream=debug".
+	Level string
+	// Format is "json" (default) or "console".
+	Format string
+	// Sinks receive every line; nil means SplitSink (stdout/stderr by level).
+	Sinks []Sink
+	// Redactor, when set, rewrites every line's fields before encoding.
+	Redactor *Redactor
+}
+
+// core is shared by a logger and all loggers derived from it.
+type core struct {
+	level     Level
+	overrides map[string]Level
+	format    string
+	sinks     []Sink
+	redactor  *Redactor
+	mu        sync.Mutex
+}
+
+// Logger writes structured lines to its sinks. A nil *Logger discards
+// everything.
 type Logger struct {
-	level Level
+	core   *core
+	name   string
+	level  Level
+	fields map[string]interface{}
 }
 
+// New returns a JSON logger writing info/debug to stdout and warn/error to
+// stderr.
 func New(level string) *Logger {
-	lvl := parseLevel(level)
-	return &Logger{level: lvl}
+	return NewWithOptions(Options{Level: level})
+}
+
+func NewWithOptions(opts Options) *Logger {
+	def, overrides := parseLevelSpec(opts.Level)
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	if format != formatConsole {
+		format = formatJSON
+	}
+	sinks := opts.Sinks
+	if len(sinks) == 0 {
+		sinks = []Sink{SplitSink()}
+	}
+	c := &core{level: def, overrides: overrides, format: format, sinks: sinks, redactor: opts.Redactor}
+	return &Logger{core: c, level: def}
+}
+
+// parseLevelSpec reads "info,upstream=debug": the bare entry sets the
+// default and name=level entries override it for Named loggers.
+func parseLevelSpec(spec string) (Level, map[string]Level) {
+	def := LevelInfo
+	overrides := map[string]Level{}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if i := strings.IndexByte(part, '='); i > 0 {
+			overrides[strings.ToLower(strings.TrimSpace(part[:i]))] = parseLevel(part[i+1:])
+			continue
+		}
+		def = parseLevel(part)
+	}
+	return def, overrides
 }
 
 func parseLevel(level string) Level {
@@ -44,49 +120,132 @@ func parseLevel(level string) Level {
 	}
 }
 
+// Named returns a logger for a component such as "upstream". Its level comes
+// from the matching override in the level spec, and lines carry a
+// "component" field.
+func (l *Logger) Named(name string) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.name = name
+	child.level = l.core.level
+	if lvl, ok := l.core.overrides[strings.ToLower(name)]; ok {
+		child.level = lvl
+	}
+	return &child
+}
+
+// With returns a child logger that adds fields to every line. Fields passed
+// to an individual call take precedence.
+func (l *Logger) With(fields map[string]interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	child := *l
+	child.fields = merged
+	return &child
+}
+
+type ctxKey struct{}
+
+// WithContext attaches l to ctx; see FromContext.
+func WithContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns the request-scoped logger attached by the HTTP
+// middleware, or nil when there is none.
+func FromContext(ctx context.Context) *Logger {
+	l, _ := ctx.Value(ctxKey{}).(*Logger)
+	return l
+}
+
+// Ctx prefers the logger carried by ctx and falls back to l, so code that
+// holds a base logger picks up request fields whenever they exist. The
+// result keeps l's component name and level.
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	if l == nil || ctx == nil {
+		return l
+	}
+	scoped := FromContext(ctx)
+	if scoped == nil || scoped.core != l.core {
+		return l
+	}
+	if scoped.name == l.name {
+		return scoped
+	}
+	return scoped.Named(l.name)
+}
+
 func (l *Logger) Enabled(level Level) bool {
-	return l.level >= level && l.level != LevelSilent
+	return l != nil && l.level >= level && l.level != LevelSilent
 }
 
 func (l *Logger) Debug(msg string, fields map[string]interface{}) {
-	l.log(LevelDebug, "debug", msg, fields)
+	l.log(LevelDebug, msg, fields)
 }
 
 func (l *Logger) Info(msg string, fields map[string]interface{}) {
-	l.log(LevelInfo, "info", msg, fields)
+	l.log(LevelInfo, msg, fields)
 }
 
 func (l *Logger) Warn(msg string, fields map[string]interface{}) {
-	l.log(LevelWarn, "warn", msg, fields)
+	l.log(LevelWarn, msg, fields)
 }
 
 func (l *Logger) Error(msg string, fields map[string]interface{}) {
-	l.log(LevelError, "error", msg, fields)
+	l.log(LevelError, msg, fields)
+}
+
+// Close flushes and closes every sink.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	var first error
+	for _, s := range l.core.sinks {
+		if err := s.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
 }
 
-func (l *Logger) log(level Level, levelName, msg string, fields map[string]interface{}) {
+func (l *Logger) log(level Level, msg string, fields map[string]interface{}) {
 	if !l.Enabled(level) {
 		return
 	}
 
-	payload := map[string]interface{}{
-		"ts":    time.Now().UTC().Format(time.RFC3339Nano),
-		"level": levelName,
-		"msg":   msg,
+	entry := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		entry[k] = v
 	}
 	for k, v := range fields {
-		payload[k] = v
+		entry[k] = v
+	}
+	entry = l.core.redactor.Apply(entry)
+	if l.name != "" {
+		entry["component"] = l.name
 	}
 
-	b, err := json.Marshal(payload)
+	line, err := l.core.encode(time.Now().UTC(), level, msg, entry)
 	if err != nil {
 		return
 	}
 
-	// Keep it simple: stdout for info/debug, stderr for warn/error.
-	if level == LevelError || level == LevelWarn {
-		_, _ = os.Stderr.Write(append(b, '\n'))
-		return
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+	for _, s := range l.core.sinks {
+		_ = s.WriteLog(level, line)
 	}
-	_, _ = os.Stdout.Write(append(b, '\n'))
 }
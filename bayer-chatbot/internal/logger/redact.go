@@ -0,0 +1,407 @@
+package logger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RedactMode says what happens to a value matched by a redaction rule.
+type RedactMode string
+
+const (
+	// RedactDrop removes the field, or the matched text for patterns.
+	RedactDrop RedactMode = "drop"
+	// RedactMask replaces the value with "[REDACTED]".
+	RedactMask RedactMode = "mask"
+	// RedactHash replaces the value with a short SHA-256 so equal values can
+	// still be correlated across lines.
+	RedactHash RedactMode = "hash"
+)
+
+const redactedText = "[REDACTED]"
+
+// BuiltinPatterns are the named patterns accepted by RedactSpec.Patterns.
+var BuiltinPatterns = map[string]string{
+	"email":  `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	"iban":   `\b[A-Z]{2}[0-9]{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`,
+	"bearer": `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,
+}
+
+// RedactSpec is the string form of the redaction rules, as read from
+// config. Each list is comma-separated and every entry may end in "=mode"
+// to override Mode.
+type RedactSpec struct {
+	// Keys are field or header names matched case-insensitively at any depth.
+	Keys string
+	// Paths are JSON paths such as "messages[*].content" or "headers.cookie",
+	// evaluated against the log fields and against any string field that
+	// holds a JSON document (such as bodyPreview).
+	Paths string
+	// Patterns are BuiltinPatterns names applied to every string value.
+	Patterns string
+	// Regex is one additional custom pattern.
+	Regex string
+	// Mode is the default mode; empty means mask.
+	Mode string
+}
+
+type pathStep struct {
+	key   string
+	index int // -1 for [*]; only used when key is ""
+}
+
+type pathRule struct {
+	steps []pathStep
+	mode  RedactMode
+	// fallback matches the path's last key as a string value in text that
+	// is not valid JSON.
+	fallback *regexp.Regexp
+}
+
+type patternRule struct {
+	re   *regexp.Regexp
+	mode RedactMode
+}
+
+// Redactor rewrites log fields before they are encoded.
+type Redactor struct {
+	keys     map[string]RedactMode
+	paths    []pathRule
+	patterns []patternRule
+}
+
+// NewRedactor compiles spec. It returns nil when no rule is configured.
+func NewRedactor(spec RedactSpec) (*Redactor, error) {
+	def := RedactMask
+	if spec.Mode != "" {
+		m, ok := parseRedactMode(spec.Mode)
+		if !ok {
+			return nil, errors.New("invalid redaction mode: " + spec.Mode)
+		}
+		def = m
+	}
+
+	r := &Redactor{keys: map[string]RedactMode{}}
+	for _, entry := range splitList(spec.Keys) {
+		name, mode, err := splitMode(entry, def)
+		if err != nil {
+			return nil, err
+		}
+		r.keys[strings.ToLower(name)] = mode
+	}
+	for _, entry := range splitList(spec.Paths) {
+		expr, mode, err := splitMode(entry, def)
+		if err != nil {
+			return nil, err
+		}
+		steps, err := parsePath(expr)
+		if err != nil {
+			return nil, err
+		}
+		rule := pathRule{steps: steps, mode: mode}
+		if last := steps[len(steps)-1]; last.key != "" {
+			rule.fallback = regexp.MustCompile(`("` + regexp.QuoteMeta(last.key) + `"\s*:\s*)("(?:[^"\\]|\\.)*(?:"|$))`)
+		}
+		r.paths = append(r.paths, rule)
+	}
+	for _, entry := range splitList(spec.Patterns) {
+		name, mode, err := splitMode(entry, def)
+		if err != nil {
+			return nil, err
+		}
+		expr, ok := BuiltinPatterns[strings.ToLower(name)]
+		if !ok {
+			return nil, errors.New("unknown redaction pattern: " + name)
+		}
+		r.patterns = append(r.patterns, patternRule{re: regexp.MustCompile(expr), mode: mode})
+	}
+	if spec.Regex != "" {
+		re, err := regexp.Compile(spec.Regex)
+		if err != nil {
+			return nil, errors.New("invalid redaction regex: " + err.Error())
+		}
+		r.patterns = append(r.patterns, patternRule{re: re, mode: def})
+	}
+
+	if len(r.keys) == 0 && len(r.paths) == 0 && len(r.patterns) == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func splitMode(entry string, def RedactMode) (string, RedactMode, error) {
+	i := strings.LastIndexByte(entry, '=')
+	if i < 0 {
+		return entry, def, nil
+	}
+	m, ok := parseRedactMode(entry[i+1:])
+	if !ok {
+		return "", "", errors.New("invalid redaction mode in " + entry)
+	}
+	return strings.TrimSpace(entry[:i]), m, nil
+}
+
+func parseRedactMode(s string) (RedactMode, bool) {
+	switch m := RedactMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case RedactDrop, RedactMask, RedactHash:
+		return m, true
+	}
+	return "", false
+}
+
+// parsePath reads "a.b[*].c" and "a[2]" style paths.
+func parsePath(expr string) ([]pathStep, error) {
+	var steps []pathStep
+	for _, part := range strings.Split(expr, ".") {
+		name := part
+		var idx []string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			name = part[:i]
+			rest := part[i:]
+			for rest != "" {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, errors.New("invalid redaction path: " + expr)
+				}
+				idx = append(idx, rest[1:end])
+				rest = rest[end+1:]
+			}
+		}
+		if name != "" {
+			steps = append(steps, pathStep{key: name})
+		}
+		for _, s := range idx {
+			if s == "*" {
+				steps = append(steps, pathStep{index: -1})
+				continue
+			}
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid redaction path index: " + expr)
+			}
+			steps = append(steps, pathStep{index: n})
+		}
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("empty redaction path")
+	}
+	return steps, nil
+}
+
+// Apply returns a redacted copy of fields; fields itself is not modified.
+func (r *Redactor) Apply(fields map[string]interface{}) map[string]interface{} {
+	if r == nil {
+		return fields
+	}
+	out, _ := r.value(normalize(fields)).(map[string]interface{})
+	for _, p := range r.paths {
+		applyPath(out, p.steps, p.mode)
+	}
+	return out
+}
+
+// normalize turns arbitrary values (structs, typed maps) into the generic
+// JSON shape so rules can see inside them.
+func normalize(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil, string, bool, int, int64, float64:
+		return x
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, vv := range x {
+			out[k] = normalize(vv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, vv := range x {
+			out[i] = normalize(vv)
+		}
+		return out
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var generic interface{}
+	if json.Unmarshal(b, &generic) != nil {
+		return v
+	}
+	return generic
+}
+
+// value applies key and pattern rules recursively. Strings holding a JSON
+// document are redacted as documents, paths included, and re-encoded.
+func (r *Redactor) value(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, vv := range x {
+			if mode, ok := r.keys[strings.ToLower(k)]; ok {
+				if mode == RedactDrop {
+					delete(x, k)
+				} else {
+					x[k] = redactWhole(vv, mode)
+				}
+				continue
+			}
+			x[k] = r.value(vv)
+		}
+		return x
+	case []interface{}:
+		for i, vv := range x {
+			x[i] = r.value(vv)
+		}
+		return x
+	case string:
+		return r.embedded(x)
+	}
+	return v
+}
+
+func (r *Redactor) embedded(s string) string {
+	t := strings.TrimSpace(s)
+	if len(t) < 2 || (t[0] != '{' && t[0] != '[') {
+		return r.text(s)
+	}
+	var doc interface{}
+	if json.Unmarshal([]byte(t), &doc) != nil {
+		// Truncated previews are not valid JSON; fall back to masking the
+		// last key of each path wherever it appears as a string value.
+		return r.text(r.pathFallback(s))
+	}
+	doc = r.value(doc)
+	if m, ok := doc.(map[string]interface{}); ok {
+		for _, p := range r.paths {
+			applyPath(m, p.steps, p.mode)
+		}
+	} else if a, ok := doc.([]interface{}); ok {
+		for _, p := range r.paths {
+			applyPath(a, p.steps, p.mode)
+		}
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return redactedText
+	}
+	return string(b)
+}
+
+func (r *Redactor) pathFallback(s string) string {
+	for _, p := range r.paths {
+		if p.fallback == nil {
+			continue
+		}
+		mode := p.mode
+		re := p.fallback
+		s = re.ReplaceAllStringFunc(s, func(m string) string {
+			sub := re.FindStringSubmatch(m)
+			switch mode {
+			case RedactHash:
+				// Hash the string value, as for valid documents, so a
+				// complete value correlates with its untruncated form.
+				v := sub[2]
+				var str string
+				if json.Unmarshal([]byte(v), &str) == nil {
+					v = str
+				}
+				return sub[1] + `"` + hashValue(v) + `"`
+			case RedactDrop:
+				return sub[1] + `null`
+			}
+			return sub[1] + `"` + redactedText + `"`
+		})
+	}
+	return s
+}
+
+func (r *Redactor) text(s string) string {
+	for _, p := range r.patterns {
+		mode := p.mode
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			switch mode {
+			case RedactDrop:
+				return ""
+			case RedactHash:
+				return hashValue(m)
+			}
+			return redactedText
+		})
+	}
+	return s
+}
+
+func applyPath(v interface{}, steps []pathStep, mode RedactMode) {
+	if len(steps) == 0 {
+		return
+	}
+	step, last := steps[0], len(steps) == 1
+	switch x := v.(type) {
+	case map[string]interface{}:
+		if step.key == "" {
+			return
+		}
+		child, ok := x[step.key]
+		if !ok {
+			return
+		}
+		if last {
+			if mode == RedactDrop {
+				delete(x, step.key)
+			} else {
+				x[step.key] = redactWhole(child, mode)
+			}
+			return
+		}
+		applyPath(child, steps[1:], mode)
+	case []interface{}:
+		if step.key != "" {
+			return
+		}
+		for i := range x {
+			if step.index >= 0 && i != step.index {
+				continue
+			}
+			if last {
+				if mode == RedactDrop {
+					x[i] = nil
+				} else {
+					x[i] = redactWhole(x[i], mode)
+				}
+				continue
+			}
+			applyPath(x[i], steps[1:], mode)
+		}
+	}
+}
+
+func redactWhole(v interface{}, mode RedactMode) interface{} {
+	if mode == RedactHash {
+		s, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+		return hashValue(s)
+	}
+	return redactedText
+}
+
+func hashValue(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactBodyPreview(t *testing.T) {
+	const full = `{"model":"gpt-4o","messages":[{"role":"user","content":"my secret"},{"role":"assistant","content":"reply"}]}`
+	tests := []struct {
+		name    string
+		mode    string
+		preview string
+		want    string
+	}{
+		{
+			name:    "valid document",
+			preview: full,
+			want:    `{"messages":[{"content":"[REDACTED]","role":"user"},{"content":"[REDACTED]","role":"assistant"}],"model":"gpt-4o"}`,
+		},
+		{
+			name:    "truncated inside content",
+			preview: `{"model":"gpt-4o","messages":[{"role":"user","content":"my sec`,
+			want:    `{"model":"gpt-4o","messages":[{"role":"user","content":"[REDACTED]"`,
+		},
+		{
+			name:    "truncated after content",
+			preview: `{"model":"gpt-4o","messages":[{"role":"user","content":"my secret"},{"role":"assi`,
+			want:    `{"model":"gpt-4o","messages":[{"role":"user","content":"[REDACTED]"},{"role":"assi`,
+		},
+		{
+			name:    "truncated with escaped quotes",
+			preview: `{"messages":[{"content":"he said \"hi\" and`,
+			want:    `{"messages":[{"content":"[REDACTED]"`,
+		},
+		{
+			name:    "truncated with spacing",
+			preview: `{"messages": [{"content" : "my secret", "role": "user"}, {"content":`,
+			want:    `{"messages": [{"content" : "[REDACTED]", "role": "user"}, {"content":`,
+		},
+		{
+			name:    "drop in truncated preview",
+			mode:    "drop",
+			preview: `{"messages":[{"content":"my secret"},{"ro`,
+			want:    `{"messages":[{"content":null},{"ro`,
+		},
+		{
+			name:    "hash in truncated preview matches full value",
+			mode:    "hash",
+			preview: `{"messages":[{"content":"my secret"},{"ro`,
+			want:    `{"messages":[{"content":"` + hashValue("my secret") + `"},{"ro`,
+		},
+		{
+			name:    "hash in valid document",
+			mode:    "hash",
+			preview: `{"messages":[{"content":"my secret"}]}`,
+			want:    `{"messages":[{"content":"` + hashValue("my secret") + `"}]}`,
+		},
+		{
+			name:    "pattern in truncated preview",
+			preview: `{"model":"gpt-4o","user":"jane@example.com","messa`,
+			want:    `{"model":"gpt-4o","user":"[REDACTED]","messa`,
+		},
+		{
+			name:    "plain text",
+			preview: "content: my secret",
+			want:    "content: my secret",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRedactor(RedactSpec{Paths: "messages[*].content", Patterns: "email", Mode: tt.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := map[string]interface{}{"bodyPreview": tt.preview}
+			got := r.Apply(in)["bodyPreview"]
+			if got != tt.want {
+				t.Errorf("bodyPreview =\n  %v\nwant\n  %v", got, tt.want)
+			}
+			if in["bodyPreview"] != tt.preview {
+				t.Error("Apply modified its input")
+			}
+		})
+	}
+}
+
+func TestRedactFields(t *testing.T) {
+	r, err := NewRedactor(RedactSpec{Keys: "authorization,cookie=drop", Paths: "messages[*].content", Patterns: "bearer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := r.Apply(map[string]interface{}{
+		"headers":  map[string]interface{}{"Authorization": "Bearer abc", "Cookie": "s=1", "Accept": "*/*"},
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}},
+		"note":     "sent bearer abc.def to upstream",
+	})
+
+	h := out["headers"].(map[string]interface{})
+	if h["Authorization"] != redactedText {
+		t.Errorf("Authorization = %v, want masked", h["Authorization"])
+	}
+	if _, ok := h["Cookie"]; ok {
+		t.Error("Cookie was not dropped")
+	}
+	if h["Accept"] != "*/*" {
+		t.Errorf("Accept = %v, want untouched", h["Accept"])
+	}
+	msg := out["messages"].([]interface{})[0].(map[string]interface{})
+	if msg["content"] != redactedText || msg["role"] != "user" {
+		t.Errorf("message = %v, want only content masked", msg)
+	}
+	if note := out["note"].(string); strings.Contains(note, "abc") {
+		t.Errorf("note = %q, want the bearer token masked", note)
+	}
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	for _, spec := range []RedactSpec{
+		{Mode: "scramble"},
+		{Keys: "authorization=scramble"},
+		{Paths: "messages[x].content"},
+		{Paths: "messages[*"},
+		{Patterns: "ssn"},
+		{Regex: "("},
+	} {
+		if _, err := NewRedactor(spec); err == nil {
+			t.Errorf("NewRedactor(%+v) succeeded, want an error", spec)
+		}
+	}
+	if r, err := NewRedactor(RedactSpec{}); r != nil || err != nil {
+		t.Errorf("empty spec = %v, %v; want nil, nil", r, err)
+	}
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink receives encoded lines. Writes are serialized by the logger.
+type Sink interface {
+	WriteLog(level Level, line []byte) error
+	Close() error
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) WriteLog(_ Level, line []byte) error {
+	_, err := s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (writerSink) Close() error { return nil }
+
+func StdoutSink() Sink { return writerSink{w: os.Stdout} }
+func StderrSink() Sink { return writerSink{w: os.Stderr} }
+
+type splitSink struct{}
+
+// SplitSink writes info/debug to stdout and warn/error to stderr.
+func SplitSink() Sink { return splitSink{} }
+
+func (splitSink) WriteLog(level Level, line []byte) error {
+	w := os.Stdout
+	if level == LevelError || level == LevelWarn {
+		w = os.Stderr
+	}
+	_, err := w.Write(append(line, '\n'))
+	return err
+}
+
+func (splitSink) Close() error { return nil }
+
+// UDPSyslogSink sends each line as an RFC 5424 message over UDP.
+type UDPSyslogSink struct {
+	conn     net.Conn
+	facility int
+	hostname string
+	appName  string
+	pid      string
+}
+
+// NewUDPSyslogSink dials addr (host:port). Messages use the local0 facility.
+func NewUDPSyslogSink(addr, appName string) (*UDPSyslogSink, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	return &UDPSyslogSink{
+		conn:     conn,
+		facility: 16,
+		hostname: host,
+		appName:  appName,
+		pid:      strconv.Itoa(os.Getpid()),
+	}, nil
+}
+
+func (s *UDPSyslogSink) WriteLog(level Level, line []byte) error {
+	pri := s.facility*8 + syslogSeverity(level)
+	header := "<" + strconv.Itoa(pri) + ">1 " + time.Now().UTC().Format(time.RFC3339Nano) + " " +
+		s.hostname + " " + s.appName + " " + s.pid + " - - "
+	_, err := s.conn.Write(append([]byte(header), line...))
+	return err
+}
+
+func (s *UDPSyslogSink) Close() error {
+	return s.conn.Close()
+}
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case LevelError:
+		return 3
+	case LevelWarn:
+		return 4
+	case LevelInfo:
+		return 6
+	}
+	return 7
+}
+
+// OpenSinks builds sinks from a comma-separated spec. Entries are "stdout",
+// "stderr", "split", "file:<path>" and "udp://host:port" (syslog).
+func OpenSinks(spec string, file FileOptions, appName string) ([]Sink, error) {
+	var sinks []Sink
+	fail := func(err error) ([]Sink, error) {
+		for _, s := range sinks {
+			_ = s.Close()
+		}
+		return nil, err
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+			continue
+		case entry == "stdout":
+			sinks = append(sinks, StdoutSink())
+		case entry == "stderr":
+			sinks = append(sinks, StderrSink())
+		case entry == "split":
+			sinks = append(sinks, SplitSink())
+		case strings.HasPrefix(entry, "file:"):
+			opts := file
+			opts.Path = strings.TrimPrefix(entry, "file:")
+			s, err := NewFileSink(opts)
+			if err != nil {
+				return fail(err)
+			}
+			sinks = append(sinks, s)
+		case strings.HasPrefix(entry, "udp://"):
+			s, err := NewUDPSyslogSink(strings.TrimPrefix(entry, "udp://"), appName)
+			if err != nil {
+				return fail(err)
+			}
+			sinks = append(sinks, s)
+		default:
+			return fail(errors.New("unknown log output: " + entry))
+		}
+	}
+	return sinks, nil
+}
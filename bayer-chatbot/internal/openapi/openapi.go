@@ -0,0 +1,249 @@
+// Package openapi builds an OpenAPI 3.1 document whose schemas are generated
+// from Go types, so the published description follows the structs the
+// handlers actually decode and encode.
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Document is an OpenAPI 3.1 document. Paths are keyed by path template and
+// then by lower-case HTTP method.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+
+	names map[reflect.Type]string
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Schema is a JSON Schema object as embedded in OpenAPI.
+type Schema map[string]interface{}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// New returns an empty document.
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    "3.1.0",
+		Info:       info,
+		Paths:      map[string]map[string]*Operation{},
+		Components: Components{Schemas: map[string]Schema{}},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+// Add registers op under method and path, e.g. ("GET", "/v1/models").
+func (d *Document) Add(method, path string, op *Operation) {
+	item, ok := d.Paths[path]
+	if !ok {
+		item = map[string]*Operation{}
+		d.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+// Has reports whether path has an operation for method.
+func (d *Document) Has(method, path string) bool {
+	_, ok := d.Paths[path][strings.ToLower(method)]
+	return ok
+}
+
+// JSON encodes the document.
+func (d *Document) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// JSONBody describes a JSON request body of v's type.
+func (d *Document) JSONBody(v interface{}) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{
+		"application/json": {Schema: d.SchemaOf(v)},
+	}}
+}
+
+// JSONResponse describes a JSON response of v's type.
+func (d *Document) JSONResponse(description string, v interface{}) Response {
+	return Response{Description: description, Content: map[string]MediaType{
+		"application/json": {Schema: d.SchemaOf(v)},
+	}}
+}
+
+// TextResponse describes a non-JSON response such as an event stream.
+func TextResponse(description, contentType string) Response {
+	return Response{Description: description, Content: map[string]MediaType{
+		contentType: {Schema: Schema{"type": "string"}},
+	}}
+}
+
+// PathParam describes a required string path parameter.
+func PathParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: Schema{"type": "string"}}
+}
+
+// QueryParam describes an optional query parameter of the given JSON type.
+func QueryParam(name, typ, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: Schema{"type": typ}}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// SchemaOf returns the schema for v's type. Named struct types are added to
+// the components and referenced.
+func (d *Document) SchemaOf(v interface{}) Schema {
+	return d.schema(reflect.TypeOf(v))
+}
+
+func (d *Document) schema(t reflect.Type) Schema {
+	if t == nil || t == rawType {
+		return Schema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return Schema{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return Schema{"type": "string"}
+	case reflect.Bool:
+		return Schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return Schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return Schema{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return Schema{"type": "array", "items": d.schema(t.Elem())}
+	case reflect.Map:
+		return Schema{"type": "object", "additionalProperties": d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.object(t)
+		}
+		return Schema{"$ref": "#/components/schemas/" + d.component(t)}
+	}
+	// interface{} and anything else accept any JSON value.
+	return Schema{}
+}
+
+// component registers t once and returns its component name. Types with the
+// same name from different packages get the package name as a prefix.
+func (d *Document) component(t reflect.Type) string {
+	if name, ok := d.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	for other := range d.names {
+		if d.names[other] == name {
+			name = pkgName(t) + name
+			break
+		}
+	}
+	d.names[t] = name
+	// Reserve the name before recursing so self-references terminate.
+	d.Components.Schemas[name] = Schema{}
+	d.Components.Schemas[name] = d.object(t)
+	return name
+}
+
+func pkgName(t reflect.Type) string {
+	p := t.PkgPath()
+	if i := strings.LastIndexByte(p, '/'); i >= 0 {
+		p = p[i+1:]
+	}
+	if p == "" {
+		return ""
+	}
+	return strings.ToUpper(p[:1]) + p[1:]
+}
+
+func (d *Document) object(t reflect.Type) Schema {
+	props := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = d.schema(f.Type)
+		if !strings.Contains(opts, ",omitempty") && f.Type.Kind() != reflect.Ptr {
+			required = append(required, name)
+		}
+	}
+	s := Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
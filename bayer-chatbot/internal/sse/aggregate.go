@@ -0,0 +1,78 @@
+package sse
+
+// Aggregate folds a normalized stream into one result: the full text, tool
+// calls with their argument fragments joined, citations, usage and how the
+// generation ended.
+type Aggregate struct {
+	Content      string            `json:"content"`
+	ToolCalls    []ToolCallPayload `json:"tool_calls,omitempty"`
+	Citations    []CitationPayload `json:"citations,omitempty"`
+	Usage        *UsagePayload     `json:"usage,omitempty"`
+	FinishReason string            `json:"finish_reason,omitempty"`
+	Error        *ErrorPayload     `json:"error,omitempty"`
+}
+
+// Add folds one event into the aggregate.
+func (a *Aggregate) Add(ev Event) {
+	switch p := ev.Payload.(type) {
+	case DeltaPayload:
+		a.Content += p.Delta
+	case ToolCallPayload:
+		for i := range a.ToolCalls {
+			tc := &a.ToolCalls[i]
+			if tc.Index != p.Index {
+				continue
+			}
+			if tc.ID == "" {
+				tc.ID = p.ID
+			}
+			if tc.Name == "" {
+				tc.Name = p.Name
+			}
+			tc.Arguments += p.Arguments
+			return
+		}
+		a.ToolCalls = append(a.ToolCalls, p)
+	case CitationPayload:
+		a.Citations = append(a.Citations, p)
+	case UsagePayload:
+		a.Usage = &p
+	case ErrorPayload:
+		// The first error is the cause; later ones are usually follow-ups.
+		if a.Error == nil {
+			a.Error = &p
+		}
+	case DonePayload:
+		a.FinishReason = p.FinishReason
+	}
+}
+
+// Done reports whether the done event was seen.
+func (a *Aggregate) Done() bool {
+	return a.FinishReason != ""
+}
+
+// Events replays the aggregate as a normalized stream, with done last.
+func (a *Aggregate) Events() []Event {
+	var out []Event
+	if a.Content != "" {
+		out = append(out, Event{Type: EventDelta, Payload: DeltaPayload{Delta: a.Content}})
+	}
+	for _, tc := range a.ToolCalls {
+		out = append(out, Event{Type: EventToolCall, Payload: tc})
+	}
+	for _, c := range a.Citations {
+		out = append(out, Event{Type: EventCitation, Payload: c})
+	}
+	if a.Usage != nil {
+		out = append(out, Event{Type: EventUsage, Payload: *a.Usage})
+	}
+	if a.Error != nil {
+		out = append(out, Event{Type: EventError, Payload: *a.Error})
+	}
+	reason := a.FinishReason
+	if reason == "" {
+		reason = "stop"
+	}
+	return append(out, Event{Type: EventDone, Payload: DonePayload{FinishReason: reason}})
+}
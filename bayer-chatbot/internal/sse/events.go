@@ -0,0 +1,75 @@
+// Package sse turns the upstream /chat/agent event stream into a small,
+// stable event set for our clients.
+//
+// Every event is sent as `event: <type>` with a JSON `data:` payload:
+//
+//	delta      {"delta":"text"}
+//	tool_call  {"index":0,"id":"call_1","name":"search","arguments":"{\"q\":"}
+//	citation   {"index":0,"title":"...","url":"...","snippet":"..."}
+//	usage      {"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}
+//	error      {"code":"upstream_error","message":"..."}
+//	done       {"finish_reason":"stop"}
+//
+// tool_call arguments may arrive in fragments; clients concatenate them by
+// index. done is always the last event of a stream.
+package sse
+
+import (
+	"encoding/json"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+const (
+	EventDelta    = "delta"
+	EventToolCall = "tool_call"
+	EventCitation = "citation"
+	EventUsage    = "usage"
+	EventError    = "error"
+	EventDone     = "done"
+)
+
+type DeltaPayload struct {
+	Delta string `json:"delta"`
+}
+
+type ToolCallPayload struct {
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+type CitationPayload struct {
+	Index   int    `json:"index"`
+	Title   string `json:"title,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+type UsagePayload struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type DonePayload struct {
+	FinishReason string `json:"finish_reason"`
+}
+
+// Event is one normalized event. Payload is one of the *Payload types above.
+type Event struct {
+	Type    string
+	Payload interface{}
+}
+
+// SSE encodes the event for utils.WriteSSE.
+func (e Event) SSE() utils.SSEEvent {
+	b, _ := json.Marshal(e.Payload)
+	return utils.SSEEvent{Event: e.Type, Data: string(b)}
+}
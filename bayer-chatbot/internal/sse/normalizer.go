@@ -0,0 +1,283 @@
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+// Normalizer decodes upstream events into normalized Events. It understands
+// OpenAI-style chunks ({choices:[{delta:{content}}]}) and the flat
+// {delta}/{text}/{content} shapes the platform also emits.
+type Normalizer struct {
+	finishReason string
+	citations    int
+	done         bool
+}
+
+func NewNormalizer() *Normalizer {
+	return &Normalizer{}
+}
+
+// Done reports whether the done event has been produced.
+func (n *Normalizer) Done() bool {
+	return n.done
+}
+
+// Push converts one upstream event. It returns nothing once done was emitted.
+func (n *Normalizer) Push(ev utils.SSEEvent) []Event {
+	if n.done {
+		return nil
+	}
+	if ev.Data == "[DONE]" {
+		return n.Finish()
+	}
+	if ev.Data == "" {
+		return nil
+	}
+
+	// Plain-text chunks, and JSON that is not an object such as 42 or
+	// "quoted", are treated as content.
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(ev.Data), &m); err != nil || m == nil {
+		if ev.Event == "error" {
+			return []Event{{Type: EventError, Payload: ErrorPayload{Code: "upstream_error", Message: ev.Data}}}
+		}
+		return []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: ev.Data}}}
+	}
+
+	if ev.Event == "error" || m["error"] != nil {
+		return []Event{{Type: EventError, Payload: errorPayloadFrom(m)}}
+	}
+
+	var out []Event
+	if choices, ok := m["choices"].([]interface{}); ok && len(choices) > 0 {
+		if c, ok := choices[0].(map[string]interface{}); ok {
+			out = append(out, n.fromChoice(c)...)
+		}
+	} else {
+		for _, k := range []string{"delta", "text", "content"} {
+			if s, ok := m[k].(string); ok && s != "" {
+				out = append(out, Event{Type: EventDelta, Payload: DeltaPayload{Delta: s}})
+				break
+			}
+		}
+		out = append(out, toolCallsFrom(m)...)
+		if s, ok := m["finish_reason"].(string); ok && s != "" {
+			n.finishReason = s
+		}
+	}
+
+	for _, k := range []string{"citations", "sources"} {
+		if list, ok := m[k].([]interface{}); ok {
+			for _, raw := range list {
+				if c, ok := raw.(map[string]interface{}); ok {
+					out = append(out, Event{Type: EventCitation, Payload: n.citationFrom(c)})
+				}
+			}
+		}
+	}
+
+	if u, ok := m["usage"].(map[string]interface{}); ok {
+		out = append(out, Event{Type: EventUsage, Payload: UsagePayload{
+			PromptTokens:     intField(u, "prompt_tokens"),
+			CompletionTokens: intField(u, "completion_tokens"),
+			TotalTokens:      intField(u, "total_tokens"),
+		}})
+	}
+
+	return out
+}
+
+// Finish returns the closing done event unless it was already emitted.
+func (n *Normalizer) Finish() []Event {
+	if n.done {
+		return nil
+	}
+	n.done = true
+	reason := n.finishReason
+	if reason == "" {
+		reason = "stop"
+	}
+	return []Event{{Type: EventDone, Payload: DonePayload{FinishReason: reason}}}
+}
+
+func (n *Normalizer) fromChoice(c map[string]interface{}) []Event {
+	var out []Event
+	if s, ok := c["finish_reason"].(string); ok && s != "" {
+		n.finishReason = s
+	}
+	d, ok := c["delta"].(map[string]interface{})
+	if !ok {
+		d, _ = c["message"].(map[string]interface{})
+	}
+	if d == nil {
+		return nil
+	}
+	if s, ok := d["content"].(string); ok && s != "" {
+		out = append(out, Event{Type: EventDelta, Payload: DeltaPayload{Delta: s}})
+	}
+	out = append(out, toolCallsFrom(d)...)
+	return out
+}
+
+func (n *Normalizer) citationFrom(c map[string]interface{}) CitationPayload {
+	p := CitationPayload{Index: n.citations}
+	n.citations++
+	p.Title, _ = c["title"].(string)
+	if s, ok := c["url"].(string); ok {
+		p.URL = s
+	} else if s, ok := c["source"].(string); ok {
+		p.URL = s
+	}
+	for _, k := range []string{"snippet", "text", "content"} {
+		if s, ok := c[k].(string); ok {
+			p.Snippet = s
+			break
+		}
+	}
+	return p
+}
+
+func toolCallsFrom(m map[string]interface{}) []Event {
+	var list []interface{}
+	if l, ok := m["tool_calls"].([]interface{}); ok {
+		list = l
+	} else if one, ok := m["tool_call"].(map[string]interface{}); ok {
+		list = []interface{}{one}
+	}
+
+	out := make([]Event, 0, len(list))
+	for i, raw := range list {
+		tc, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		p := ToolCallPayload{Index: i}
+		if _, ok := tc["index"]; ok {
+			p.Index = intField(tc, "index")
+		}
+		p.ID, _ = tc["id"].(string)
+		p.Name, _ = tc["name"].(string)
+		p.Arguments = stringOrJSON(tc["arguments"])
+		if fn, ok := tc["function"].(map[string]interface{}); ok {
+			if s, ok := fn["name"].(string); ok {
+				p.Name = s
+			}
+			if a := stringOrJSON(fn["arguments"]); a != "" {
+				p.Arguments = a
+			}
+		}
+		out = append(out, Event{Type: EventToolCall, Payload: p})
+	}
+	return out
+}
+
+func errorPayloadFrom(m map[string]interface{}) ErrorPayload {
+	p := ErrorPayload{Code: "upstream_error"}
+	switch e := m["error"].(type) {
+	case string:
+		p.Message = e
+	case map[string]interface{}:
+		if s, ok := e["code"].(string); ok && s != "" {
+			p.Code = s
+		}
+		p.Message, _ = e["message"].(string)
+	}
+	if p.Message == "" {
+		if s, ok := m["message"].(string); ok {
+			p.Message = s
+		} else if s, ok := m["detail"].(string); ok {
+			p.Message = s
+		}
+	}
+	return p
+}
+
+func intField(m map[string]interface{}, key string) int {
+	if f, ok := m[key].(float64); ok {
+		return int(f)
+	}
+	return 0
+}
+
+func stringOrJSON(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
+
+// Relay reads upstream events from src and passes normalized events to emit.
+// A done event is always emitted last unless emit fails. Read errors other
+// than EOF are passed on as an error event. An emit error stops the relay and
+// is returned.
+func Relay(src io.Reader, emit func(Event) error) error {
+	n := NewNormalizer()
+	var emitErr error
+	readErr := utils.ReadSSE(src, func(ev utils.SSEEvent) error {
+		for _, out := range n.Push(ev) {
+			if err := emit(out); err != nil {
+				emitErr = err
+				return err
+			}
+		}
+		if n.Done() {
+			return io.EOF
+		}
+		return nil
+	})
+	if emitErr != nil {
+		return emitErr
+	}
+
+	var tail []Event
+	if readErr != nil && readErr != io.EOF {
+		tail = append(tail, Event{Type: EventError, Payload: Interrupted(readErr)})
+	}
+	tail = append(tail, n.Finish()...)
+	for _, out := range tail {
+		if err := emit(out); err != nil {
+			return err
+		}
+	}
+	if readErr == io.EOF {
+		return nil
+	}
+	return readErr
+}
+
+// Interrupted describes a failed upstream read to the client. An upstream
+// that went quiet for too long gets its own code so callers can tell it from
+// a dropped connection.
+func Interrupted(err error) ErrorPayload {
+	var idle *utils.IdleError
+	if errors.As(err, &idle) {
+		return ErrorPayload{Code: "upstream_idle_timeout", Message: err.Error()}
+	}
+	return ErrorPayload{Code: "stream_interrupted", Message: err.Error()}
+}
+
+// CollectText replays a raw upstream stream through a Normalizer and returns
+// the concatenated delta text.
+func CollectText(src io.Reader) (string, error) {
+	n := NewNormalizer()
+	var b strings.Builder
+	err := utils.ReadSSE(src, func(ev utils.SSEEvent) error {
+		for _, out := range n.Push(ev) {
+			if p, ok := out.Payload.(DeltaPayload); ok {
+				b.WriteString(p.Delta)
+			}
+		}
+		return nil
+	})
+	return b.String(), err
+}
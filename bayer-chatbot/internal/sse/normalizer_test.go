@@ -0,0 +1,35 @@
+package sse
+
+import (
+	"reflect"
+	"testing"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+func TestNormalizerPush(t *testing.T) {
+	tests := []struct {
+		name string
+		in   utils.SSEEvent
+		want []Event
+	}{
+		{"plain text", utils.SSEEvent{Data: "hello"}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: "hello"}}}},
+		{"number", utils.SSEEvent{Data: "42"}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: "42"}}}},
+		{"bool", utils.SSEEvent{Data: "true"}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: "true"}}}},
+		{"string", utils.SSEEvent{Data: `"quoted"`}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: `"quoted"`}}}},
+		{"array", utils.SSEEvent{Data: `[1,2]`}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: `[1,2]`}}}},
+		{"flat delta", utils.SSEEvent{Data: `{"delta":"hi"}`}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: "hi"}}}},
+		{"openai chunk", utils.SSEEvent{Data: `{"choices":[{"delta":{"content":"hi"}}]}`}, []Event{{Type: EventDelta, Payload: DeltaPayload{Delta: "hi"}}}},
+		{"plain error", utils.SSEEvent{Event: "error", Data: "boom"}, []Event{{Type: EventError, Payload: ErrorPayload{Code: "upstream_error", Message: "boom"}}}},
+		{"empty", utils.SSEEvent{Data: ""}, nil},
+		{"done", utils.SSEEvent{Data: "[DONE]"}, []Event{{Type: EventDone, Payload: DonePayload{FinishReason: "stop"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewNormalizer().Push(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Push(%q) = %#v, want %#v", tt.in.Data, got, tt.want)
+			}
+		})
+	}
+}
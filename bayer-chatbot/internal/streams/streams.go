@@ -0,0 +1,368 @@
+// Package streams keeps the recent events of chat generations so a caller
+// whose connection drops can reconnect with Last-Event-ID and continue.
+//
+// A Stream is written by one producer (the goroutine reading the upstream)
+// and read by any number of followers. Events get increasing numeric ids
+// starting at 1; only the newest MaxEvents are kept.
+package streams
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+var (
+	// ErrNotFound is returned for unknown or already evicted streams.
+	ErrNotFound = errors.New("stream not found")
+	// ErrExpired means events after the requested id were dropped from the
+	// replay buffer, so the stream cannot be resumed without a gap.
+	ErrExpired = errors.New("events after the last event id are no longer buffered")
+	// ErrFull is returned by Create when MaxStreams live streams are held.
+	ErrFull = errors.New("too many streams")
+	// ErrAbandoned is the cancel cause of a stream nobody followed for the
+	// Abandon period.
+	ErrAbandoned = errors.New("no client followed the stream")
+)
+
+type Options struct {
+	// MaxEvents bounds the replay buffer of each stream. Default 1000.
+	MaxEvents int
+	// Retention is how long a finished stream stays resumable. Default 2m.
+	Retention time.Duration
+	// MaxStreams bounds the streams held. When it is reached, the oldest
+	// finished stream is dropped for a new one, and Create fails with
+	// ErrFull if all are live. Zero means no limit.
+	MaxStreams int
+	// Abandon cancels a live stream once it had no follower for this long.
+	// Zero keeps streams running without followers.
+	Abandon time.Duration
+}
+
+// Registry holds live and recently finished streams.
+type Registry struct {
+	opts Options
+
+	mu      sync.Mutex
+	streams map[string]*Stream
+}
+
+func NewRegistry(opts Options) *Registry {
+	if opts.MaxEvents <= 0 {
+		opts.MaxEvents = 1000
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 2 * time.Minute
+	}
+	return &Registry{opts: opts, streams: map[string]*Stream{}}
+}
+
+// Create registers a new stream. owner is checked again by Get so only the
+// caller that started a stream can resume it. cancel stops the generation
+// feeding the stream; it is called by Cancel and on abandonment and may be
+// nil.
+func (r *Registry) Create(owner string, cancel context.CancelCauseFunc) (*Stream, error) {
+	return r.CreateWithID(newID(), owner, cancel)
+}
+
+// CreateWithID is Create for callers that already own a unique id, such as a
+// job id. An existing stream with the same id is replaced.
+func (r *Registry) CreateWithID(id, owner string, cancel context.CancelCauseFunc) (*Stream, error) {
+	s := &Stream{
+		ID:      id,
+		owner:   owner,
+		first:   1,
+		max:     r.opts.MaxEvents,
+		changed: make(chan struct{}),
+		cancel:  cancel,
+	}
+	if cancel != nil {
+		s.abandon = r.opts.Abandon
+	}
+	s.onClose = func() {
+		time.AfterFunc(r.opts.Retention, func() { r.remove(s) })
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, replaced := r.streams[id]; !replaced && r.opts.MaxStreams > 0 && len(r.streams) >= r.opts.MaxStreams {
+		if !r.evictLocked() {
+			return nil, ErrFull
+		}
+	}
+	r.streams[id] = s
+	return s, nil
+}
+
+// evictLocked drops the stream that finished first, if any has.
+func (r *Registry) evictLocked() bool {
+	var oldest *Stream
+	var oldestAt time.Time
+	for _, s := range r.streams {
+		s.mu.Lock()
+		closed, at := s.closed, s.closedAt
+		s.mu.Unlock()
+		if closed && (oldest == nil || at.Before(oldestAt)) {
+			oldest, oldestAt = s, at
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(r.streams, oldest.ID)
+	return true
+}
+
+// Get returns the stream with id if it belongs to owner.
+func (r *Registry) Get(id, owner string) (*Stream, error) {
+	r.mu.Lock()
+	s, ok := r.streams[id]
+	r.mu.Unlock()
+	if !ok || s.owner != owner {
+		return nil, ErrNotFound
+	}
+	return s, nil
+}
+
+// Len reports how many streams are held, live or finished.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.streams)
+}
+
+// Remove forgets a stream; later Gets return ErrNotFound.
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	delete(r.streams, id)
+	r.mu.Unlock()
+}
+
+// remove forgets s unless its id was reused since.
+func (r *Registry) remove(s *Stream) {
+	r.mu.Lock()
+	if r.streams[s.ID] == s {
+		delete(r.streams, s.ID)
+	}
+	r.mu.Unlock()
+}
+
+// Stream is the replay buffer of one generation.
+type Stream struct {
+	ID    string
+	owner string
+	max   int
+
+	mu sync.Mutex
+	// events is a ring once it holds max events; head indexes the oldest,
+	// whose id is first.
+	events   []utils.SSEEvent
+	head     int
+	first    int64
+	closed   bool
+	closedAt time.Time
+	changed  chan struct{} // closed and replaced on every Append and Close
+	onClose  func()
+
+	cancel    context.CancelCauseFunc
+	abandon   time.Duration
+	followers int
+	idle      *time.Timer // runs cancel once nobody followed for abandon
+}
+
+// Append assigns the next id to ev and buffers it, dropping the oldest event
+// when the buffer is full. Events appended after Close are ignored.
+func (s *Stream) Append(ev utils.SSEEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	ev.ID = strconv.FormatInt(s.first+int64(len(s.events)), 10)
+	if len(s.events) < s.max {
+		s.events = append(s.events, ev)
+	} else {
+		s.events[s.head] = ev
+		s.head = (s.head + 1) % s.max
+		s.first++
+	}
+	s.notify()
+}
+
+// Close marks the generation finished. The stream stays resumable for the
+// registry's retention period.
+func (s *Stream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closedAt = time.Now()
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.notify()
+	if s.onClose != nil {
+		s.onClose()
+	}
+}
+
+// Cancel stops the generation feeding s with cause. The producer still
+// appends its final events and closes s.
+func (s *Stream) Cancel(cause error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed && s.cancel != nil {
+		s.cancel(cause)
+	}
+}
+
+// attach and detach count followers; the last one leaving a live stream
+// starts the abandon timer.
+func (s *Stream) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.followers++
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+}
+
+func (s *Stream) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.followers--
+	if s.followers > 0 || s.closed || s.abandon <= 0 {
+		return
+	}
+	if s.idle == nil {
+		s.idle = time.AfterFunc(s.abandon, s.abandoned)
+	} else {
+		s.idle.Reset(s.abandon)
+	}
+}
+
+func (s *Stream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// abandoned cancels s unless a follower attached while the timer fired.
+func (s *Stream) abandoned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.followers == 0 && !s.closed {
+		s.cancel(ErrAbandoned)
+	}
+}
+
+// since returns buffered events with ids above after, a channel closed on
+// the next change, and whether the stream is finished.
+func (s *Stream) since(after int64) ([]utils.SSEEvent, <-chan struct{}, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if after < s.first-1 {
+		return nil, nil, false, ErrExpired
+	}
+	skip := after - s.first + 1
+	if skip > int64(len(s.events)) {
+		skip = int64(len(s.events))
+	}
+	out := make([]utils.SSEEvent, 0, int64(len(s.events))-skip)
+	for i := int(skip); i < len(s.events); i++ {
+		out = append(out, s.events[(s.head+i)%len(s.events)])
+	}
+	return out, s.changed, s.closed, nil
+}
+
+// Check reports ErrExpired when events after the id after were dropped.
+// Callers use it to refuse a resume before committing to a response.
+func (s *Stream) Check(after int64) error {
+	_, _, _, err := s.since(after)
+	return err
+}
+
+// Heartbeat keeps an idle follower's connection alive: Ping runs every
+// Every while no events arrive. A zero Heartbeat sends none.
+type Heartbeat struct {
+	Every time.Duration
+	Ping  func() error
+}
+
+// Follow calls fn for every event with an id above after, first from the
+// buffer and then live, until the stream is finished, ctx is done or fn or
+// the heartbeat fails. A follower that falls behind the buffer gets
+// ErrExpired.
+func (s *Stream) Follow(ctx context.Context, after int64, hb Heartbeat, fn func(utils.SSEEvent) error) error {
+	s.attach()
+	defer s.detach()
+
+	var heartbeat <-chan time.Time
+	if hb.Every > 0 && hb.Ping != nil {
+		ticker := time.NewTicker(hb.Every)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	for {
+		events, changed, closed, err := s.since(after)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if err := fn(ev); err != nil {
+				return err
+			}
+			after, _ = strconv.ParseInt(ev.ID, 10, 64)
+		}
+		if closed && len(events) == 0 {
+			return nil
+		}
+		if len(events) > 0 {
+			continue
+		}
+		if err := wait(ctx, changed, heartbeat, hb.Ping); err != nil {
+			return err
+		}
+	}
+}
+
+// wait blocks until changed is closed, pinging on every heartbeat tick.
+func wait(ctx context.Context, changed <-chan struct{}, heartbeat <-chan time.Time, ping func() error) error {
+	for {
+		select {
+		case <-changed:
+			return nil
+		case <-heartbeat:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ParseEventID reads a Last-Event-ID value; empty means from the start.
+func ParseEventID(v string) (int64, bool) {
+	if v == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
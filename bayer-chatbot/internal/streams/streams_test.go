@@ -0,0 +1,170 @@
+package streams
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"bayer-chatbot-service/internal/utils"
+)
+
+// filled returns a closed stream that was sent n events with data 1..n
+// through a buffer of max.
+func filled(t *testing.T, max, n int) *Stream {
+	t.Helper()
+	s, err := NewRegistry(Options{MaxEvents: max}).Create("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		s.Append(utils.SSEEvent{Event: "delta", Data: strconv.Itoa(i)})
+	}
+	s.Close()
+	return s
+}
+
+func TestFollowAcrossWrap(t *testing.T) {
+	tests := []struct {
+		name    string
+		max, n  int
+		after   int64
+		want    string // ids, which equal the data
+		wantErr error
+	}{
+		{"empty", 3, 0, 0, "", nil},
+		{"below capacity", 3, 2, 0, "1,2", nil},
+		{"exactly full", 3, 3, 0, "1,2,3", nil},
+		{"wrapped once", 3, 4, 1, "2,3,4", nil},
+		{"wrapped twice", 3, 7, 4, "5,6,7", nil},
+		{"wrapped, partial replay", 3, 7, 5, "6,7", nil},
+		{"wrapped, caught up", 3, 7, 7, "", nil},
+		{"after beyond the end", 3, 7, 9, "", nil},
+		{"dropped", 3, 7, 3, "", ErrExpired},
+		{"dropped from the start", 3, 4, 0, "", ErrExpired},
+		{"single slot", 1, 5, 4, "5", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := filled(t, tt.max, tt.n)
+			if err := s.Check(tt.after); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check(%d) = %v, want %v", tt.after, err, tt.wantErr)
+			}
+
+			var got []string
+			err := s.Follow(context.Background(), tt.after, Heartbeat{}, func(ev utils.SSEEvent) error {
+				if ev.ID != ev.Data {
+					t.Errorf("event %q has id %q", ev.Data, ev.ID)
+				}
+				got = append(got, ev.ID)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Follow = %v, want %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("Follow ids = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowLiveAcrossWrap(t *testing.T) {
+	s, _ := NewRegistry(Options{MaxEvents: 2}).Create("", nil)
+	got := make(chan string)
+	go func() {
+		_ = s.Follow(context.Background(), 0, Heartbeat{}, func(ev utils.SSEEvent) error {
+			got <- ev.Data
+			return nil
+		})
+		close(got)
+	}()
+	for i := 1; i <= 5; i++ {
+		s.Append(utils.SSEEvent{Data: strconv.Itoa(i)})
+		if d := <-got; d != strconv.Itoa(i) {
+			t.Fatalf("followed %q, want %d", d, i)
+		}
+	}
+	s.Close()
+	if _, open := <-got; open {
+		t.Error("Follow kept going after Close")
+	}
+}
+
+func TestRegistryCapacity(t *testing.T) {
+	r := NewRegistry(Options{MaxStreams: 2})
+	a, _ := r.Create("", nil)
+	b, _ := r.Create("", nil)
+	if _, err := r.Create("", nil); !errors.Is(err, ErrFull) {
+		t.Fatalf("Create with only live streams = %v, want ErrFull", err)
+	}
+
+	b.Close()
+	time.Sleep(time.Millisecond)
+	a.Close()
+	c, err := r.Create("", nil)
+	if err != nil {
+		t.Fatalf("Create with finished streams: %v", err)
+	}
+	if _, err := r.Get(b.ID, ""); !errors.Is(err, ErrNotFound) {
+		t.Error("the stream that finished first was kept")
+	}
+	for _, s := range []*Stream{a, c} {
+		if _, err := r.Get(s.ID, ""); err != nil {
+			t.Errorf("Get(%s) = %v", s.ID, err)
+		}
+	}
+	if _, err := r.CreateWithID(c.ID, "", nil); err != nil {
+		t.Errorf("replacing a stream at capacity = %v", err)
+	}
+}
+
+func TestAbandon(t *testing.T) {
+	r := NewRegistry(Options{Abandon: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s, _ := r.Create("", cancel)
+
+	// A follower that stays attached keeps the generation alive.
+	fctx, leave := context.WithCancel(context.Background())
+	followed := make(chan struct{})
+	go func() {
+		_ = s.Follow(fctx, 0, Heartbeat{}, func(utils.SSEEvent) error { return nil })
+		close(followed)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("canceled while followed")
+	}
+
+	leave()
+	<-followed
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("not canceled after the last follower left")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrAbandoned) {
+		t.Errorf("cause = %v, want ErrAbandoned", cause)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s, _ := NewRegistry(Options{}).Create("", cancel)
+	stop := errors.New("stop")
+	s.Cancel(stop)
+	if context.Cause(ctx) != stop {
+		t.Errorf("cause = %v, want %v", context.Cause(ctx), stop)
+	}
+
+	// Finished streams ignore Cancel.
+	ctx, cancel = context.WithCancelCause(context.Background())
+	s, _ = NewRegistry(Options{}).Create("", cancel)
+	s.Close()
+	s.Cancel(stop)
+	if ctx.Err() != nil {
+		t.Error("Cancel after Close canceled the generation")
+	}
+}
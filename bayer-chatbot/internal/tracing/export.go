@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bayer-chatbot-service/internal/logger"
+)
+
+// LogExporter writes each span as a debug log line. It is the fallback when
+// no collector is configured.
+type LogExporter struct {
+	logr *logger.Logger
+}
+
+func NewLogExporter(logr *logger.Logger) *LogExporter {
+	return &LogExporter{logr: logr}
+}
+
+func (e *LogExporter) ExportSpan(s *Span) {
+	if e.logr == nil || !e.logr.Enabled(logger.LevelDebug) {
+		return
+	}
+	end, attrs, errored, msg := s.snapshot()
+	fields := map[string]interface{}{
+		"traceId":    s.sc.TraceIDString(),
+		"spanId":     s.sc.SpanIDString(),
+		"name":       s.name,
+		"kind":       s.kind.String(),
+		"durationMs": end.Sub(s.start).Milliseconds(),
+		"attributes": attrs,
+	}
+	if s.parent != ([8]byte{}) {
+		fields["parentSpanId"] = hex.EncodeToString(s.parent[:])
+	}
+	if errored {
+		fields["error"] = msg
+	}
+	e.logr.Debug("trace.span", fields)
+}
+
+func (e *LogExporter) Shutdown(context.Context) error { return nil }
+
+// OTLPExporter batches spans and posts them to an OTLP/HTTP collector using
+// the JSON encoding. Spans are dropped, not blocked on, when the queue is
+// full.
+type OTLPExporter struct {
+	url     string
+	headers map[string]string
+	service string
+	logr    *logger.Logger
+	client  *http.Client
+
+	queue chan *Span
+	flush chan chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mu      sync.Mutex
+	dropped int
+}
+
+const (
+	otlpQueueSize     = 2048
+	otlpBatchSize     = 256
+	otlpFlushInterval = 5 * time.Second
+)
+
+// NewOTLPExporter exports to endpoint, a collector base URL such as
+// http://localhost:4318; "/v1/traces" is appended unless already present.
+func NewOTLPExporter(endpoint string, headers map[string]string, service string, logr *logger.Logger) *OTLPExporter {
+	u := strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(u, "/v1/traces") {
+		u += "/v1/traces"
+	}
+	e := &OTLPExporter{
+		url:     u,
+		headers: headers,
+		service: service,
+		logr:    logr,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *Span, otlpQueueSize),
+		flush:   make(chan chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+func (e *OTLPExporter) ExportSpan(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// Shutdown sends any queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case e.flush <- ack:
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) loop() {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				e.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				e.send(batch)
+				batch = nil
+			}
+		case ack := <-e.flush:
+			for drained := false; !drained; {
+				select {
+				case s := <-e.queue:
+					batch = append(batch, s)
+				default:
+					drained = true
+				}
+			}
+			if len(batch) > 0 {
+				e.send(batch)
+			}
+			close(e.done)
+			close(ack)
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []*Span) {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 && e.logr != nil {
+		e.logr.Warn("trace.dropped", map[string]interface{}{"spans": dropped})
+	}
+
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("content-type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := e.client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+		_ = res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			err = errString("collector returned " + res.Status)
+		}
+	}
+	if err != nil && e.logr != nil {
+		e.logr.Warn("trace.export_failed", map[string]interface{}{
+			"url":   e.url,
+			"spans": len(batch),
+			"error": err.Error(),
+		})
+	}
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
+
+// encode builds an ExportTraceServiceRequest in OTLP/JSON form: ids are hex
+// and 64-bit integers are strings.
+func (e *OTLPExporter) encode(batch []*Span) map[string]interface{} {
+	spans := make([]interface{}, 0, len(batch))
+	for _, s := range batch {
+		end, attrs, errored, msg := s.snapshot()
+		span := map[string]interface{}{
+			"traceId":           s.sc.TraceIDString(),
+			"spanId":            s.sc.SpanIDString(),
+			"name":              s.name,
+			"kind":              int(s.kind),
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+			"attributes":        otlpAttributes(attrs),
+			"status":            map[string]interface{}{"code": 0},
+		}
+		if s.parent != ([8]byte{}) {
+			span["parentSpanId"] = hex.EncodeToString(s.parent[:])
+		}
+		if s.sc.TraceState != "" {
+			span["traceState"] = s.sc.TraceState
+		}
+		if errored {
+			span["status"] = map[string]interface{}{"code": 2, "message": msg}
+		}
+		spans = append(spans, span)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": e.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "bayer-chatbot-service/internal/tracing"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		var v map[string]interface{}
+		switch x := attrs[k].(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": x}
+		case bool:
+			v = map[string]interface{}{"boolValue": x}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(x)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": x}
+		default:
+			b, _ := json.Marshal(x)
+			v = map[string]interface{}{"stringValue": string(b)}
+		}
+		out = append(out, map[string]interface{}{"key": k, "value": v})
+	}
+	return out
+}
+
+// ParseHeaders reads "key=value" pairs separated by commas, the format of
+// OTEL_EXPORTER_OTLP_HEADERS.
+func ParseHeaders(spec string) map[string]string {
+	out := map[string]string{}
+	for _, kv := range strings.Split(spec, ",") {
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			continue
+		}
+		out[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SpanKind follows the OTLP enum.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case KindServer:
+		return "server"
+	case KindClient:
+		return "client"
+	}
+	return "internal"
+}
+
+// Exporter receives sampled spans once they end.
+type Exporter interface {
+	ExportSpan(s *Span)
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer starts spans and hands them to an exporter. A nil *Tracer records
+// nothing but still lets remote parents propagate.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exp Exporter) *Tracer {
+	return &Tracer{exporter: exp}
+}
+
+// Start begins a span as a child of the span (or remote parent) in ctx; a new
+// trace is started when there is none.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	parent := SpanContextFromContext(ctx)
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  map[string]interface{}{},
+	}
+	if parent.IsValid() {
+		s.parent = parent.SpanID
+		s.sc = SpanContext{TraceID: parent.TraceID, Flags: parent.Flags, TraceState: parent.TraceState}
+	} else {
+		s.sc = SpanContext{TraceID: newTraceID(), Flags: flagSampled}
+	}
+	s.sc.SpanID = newSpanID()
+	return ContextWithSpan(ctx, s), s
+}
+
+// Shutdown flushes the exporter.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown(ctx)
+}
+
+// Span is a timed operation. All methods are safe on a nil *Span.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   SpanKind
+	start  time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	ended     bool
+	attrs     map[string]interface{}
+	errored   bool
+	statusMsg string
+}
+
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// SetAttribute records a string, bool, integer or float attribute.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(msg string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errored = true
+	s.statusMsg = msg
+}
+
+// End finishes the span and exports it if sampled. Later calls are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(s)
+	}
+}
+
+// snapshot copies the mutable fields for exporters.
+func (s *Span) snapshot() (end time.Time, attrs map[string]interface{}, errored bool, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attrs = make(map[string]interface{}, len(s.attrs))
+	for k, v := range s.attrs {
+		attrs[k] = v
+	}
+	return s.end, attrs, s.errored, s.statusMsg
+}
@@ -0,0 +1,193 @@
+// Package tracing implements W3C Trace Context propagation and a minimal
+// span recorder that exports to an OTLP/HTTP JSON collector or, without one,
+// to the service logger.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+const flagSampled = 0x01
+
+// SpanContext identifies a span within a trace, as carried by traceparent.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+	// Remote is set when the context was received from a caller.
+	Remote bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+func (sc SpanContext) TraceIDString() string {
+	return hex.EncodeToString(sc.TraceID[:])
+}
+
+func (sc SpanContext) SpanIDString() string {
+	return hex.EncodeToString(sc.SpanID[:])
+}
+
+// Traceparent renders the version-00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceIDString() + "-" + sc.SpanIDString() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header. Unknown future versions are
+// accepted as long as the version-00 prefix is well formed, as the spec
+// requires.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	v = strings.TrimSpace(v)
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return sc, false
+	}
+	version, ok := decodeLowerHex(v[0:2])
+	if !ok || version[0] == 0xff {
+		return sc, false
+	}
+	if version[0] == 0 && len(v) != 55 {
+		return sc, false
+	}
+	if len(v) > 55 && v[55] != '-' {
+		return sc, false
+	}
+
+	traceID, ok := decodeLowerHex(v[3:35])
+	if !ok {
+		return sc, false
+	}
+	spanID, ok := decodeLowerHex(v[36:52])
+	if !ok {
+		return sc, false
+	}
+	flags, ok := decodeLowerHex(v[53:55])
+	if !ok {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// decodeLowerHex rejects upper-case hex, which traceparent forbids.
+func decodeLowerHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// cleanTracestate keeps a tracestate header only when it is within the
+// spec's limits (512 characters, 32 list members of key=value).
+func cleanTracestate(v string) string {
+	v = strings.TrimSpace(v)
+	if v == "" || len(v) > 512 {
+		return ""
+	}
+	members := strings.Split(v, ",")
+	if len(members) > 32 {
+		return ""
+	}
+	for _, m := range members {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if i := strings.IndexByte(m, '='); i <= 0 || i == len(m)-1 {
+			return ""
+		}
+	}
+	return v
+}
+
+// Extract reads traceparent and tracestate from inbound headers.
+func Extract(h http.Header) (SpanContext, bool) {
+	sc, ok := ParseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc.TraceState = cleanTracestate(strings.Join(h.Values(TracestateHeader), ","))
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject writes the span context active in ctx to outbound headers.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithRemote attaches a caller's span context as the parent for spans
+// started from ctx.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// SpanContextFromContext returns the active span's context, or the remote
+// parent when no local span has been started.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+func newTraceID() (id [16]byte) {
+	for id == ([16]byte{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id [8]byte) {
+	for id == ([8]byte{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+	tests := []struct {
+		name    string
+		in      string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + traceID + "-" + spanID + "-01", true, true},
+		{"not sampled", "00-" + traceID + "-" + spanID + "-00", true, false},
+		{"surrounding space", "  00-" + traceID + "-" + spanID + "-01 ", true, true},
+		{"future version", "01-" + traceID + "-" + spanID + "-01", true, true},
+		{"future version with suffix", "cc-" + traceID + "-" + spanID + "-01-what-the-future-holds", true, true},
+		{"future version bad suffix", "cc-" + traceID + "-" + spanID + "-01x", false, false},
+		{"version 00 with suffix", "00-" + traceID + "-" + spanID + "-01-extra", false, false},
+		{"version ff", "ff-" + traceID + "-" + spanID + "-01", false, false},
+		{"upper-case hex", "00-" + strings.ToUpper(traceID) + "-" + spanID + "-01", false, false},
+		{"zero trace id", "00-" + strings.Repeat("0", 32) + "-" + spanID + "-01", false, false},
+		{"zero span id", "00-" + traceID + "-" + strings.Repeat("0", 16) + "-01", false, false},
+		{"short", "00-" + traceID[:31] + "-" + spanID + "-01", false, false},
+		{"wrong separator", "00_" + traceID + "-" + spanID + "-01", false, false},
+		{"bad flags", "00-" + traceID + "-" + spanID + "-0g", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.in)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if sc.TraceIDString() != traceID || sc.SpanIDString() != spanID {
+				t.Errorf("ids = %s/%s, want %s/%s", sc.TraceIDString(), sc.SpanIDString(), traceID, spanID)
+			}
+			if sc.Sampled() != tt.sampled {
+				t.Errorf("Sampled() = %v, want %v", sc.Sampled(), tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	in := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(in)
+	if !ok {
+		t.Fatal("valid traceparent rejected")
+	}
+	if got := sc.Traceparent(); got != in {
+		t.Errorf("Traceparent() = %q, want %q", got, in)
+	}
+}
+
+func TestExtractTracestate(t *testing.T) {
+	tests := []struct {
+		name  string
+		state []string
+		want  string
+	}{
+		{"kept", []string{"congo=t61rcWkgMzE"}, "congo=t61rcWkgMzE"},
+		{"joined", []string{"a=1", "b=2"}, "a=1,b=2"},
+		{"missing value", []string{"a="}, ""},
+		{"too long", []string{"a=" + strings.Repeat("x", 511)}, ""},
+		{"too many members", []string{strings.Repeat("k=v,", 32) + "k=v"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			for _, v := range tt.state {
+				h.Add(TracestateHeader, v)
+			}
+			sc, ok := Extract(h)
+			if !ok || !sc.Remote {
+				t.Fatalf("Extract ok = %v, remote = %v", ok, sc.Remote)
+			}
+			if sc.TraceState != tt.want {
+				t.Errorf("TraceState = %q, want %q", sc.TraceState, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Assistant management calls. Each returns the raw upstream JSON body; the
+// handlers own the response shapes. Endpoint keys are fixed templates so
+// assistant IDs and user emails never become breaker or metric labels.
+
+func assistantPath(id string) string {
+	return "/assistants/" + url.PathEscape(id)
+}
+
+func (c *Client) ListAssistants(ctx context.Context, query url.Values, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "GET /assistants", http.MethodGet, "/assistants", query, nil, requestID)
+	return body, err
+}
+
+func (c *Client) GetAssistant(ctx context.Context, id, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "GET /assistants/{id}", http.MethodGet, assistantPath(id), nil, nil, requestID)
+	return body, err
+}
+
+func (c *Client) CreateAssistant(ctx context.Context, payload []byte, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "POST /assistants", http.MethodPost, "/assistants", nil, payload, requestID)
+	return body, err
+}
+
+func (c *Client) UpdateAssistant(ctx context.Context, id string, payload []byte, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "PATCH /assistants/{id}", http.MethodPatch, assistantPath(id), nil, payload, requestID)
+	return body, err
+}
+
+func (c *Client) DeleteAssistant(ctx context.Context, id, requestID string) error {
+	_, _, err := c.doJSON(ctx, "DELETE /assistants/{id}", http.MethodDelete, assistantPath(id), nil, nil, requestID)
+	return err
+}
+
+func (c *Client) ListAssistantUsers(ctx context.Context, id, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "GET /assistants/{id}/users", http.MethodGet, assistantPath(id)+"/users", nil, nil, requestID)
+	return body, err
+}
+
+func (c *Client) AddAssistantUser(ctx context.Context, id string, payload []byte, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "POST /assistants/{id}/users", http.MethodPost, assistantPath(id)+"/users", nil, payload, requestID)
+	return body, err
+}
+
+func (c *Client) RemoveAssistantUser(ctx context.Context, id, userID, requestID string) error {
+	path := assistantPath(id) + "/users/" + url.PathEscape(userID)
+	_, _, err := c.doJSON(ctx, "DELETE /assistants/{id}/users/{userId}", http.MethodDelete, path, nil, nil, requestID)
+	return err
+}
+
+func (c *Client) ListTools(ctx context.Context, requestID string) ([]byte, error) {
+	_, body, err := c.doJSON(ctx, "GET /tools", http.MethodGet, "/tools", nil, nil, requestID)
+	return body, err
+}
@@ -0,0 +1,252 @@
+package upstream
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched (via errors.Is) by every *CircuitOpenError.
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// CircuitOpenError is returned without contacting the upstream while the
+// endpoint's breaker is open, or while its half-open probe is in flight.
+type CircuitOpenError struct {
+	Endpoint   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return "upstream circuit open: " + e.Endpoint
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// BreakerPolicy configures the per-endpoint circuit breakers. A breaker opens
+// when at least MinRequests calls were made within Window and the share of
+// failures reaches FailureRate. After Cooldown a single probe is let through.
+// A FailureRate of 0 disables the breakers.
+type BreakerPolicy struct {
+	Window      time.Duration
+	MinRequests int
+	FailureRate float64
+	Cooldown    time.Duration
+}
+
+// CircuitSnapshot is the externally visible state of one breaker.
+type CircuitSnapshot struct {
+	State    string     `json:"state"`
+	Requests int        `json:"requests"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"openedAt,omitempty"`
+}
+
+type outcome struct {
+	at     time.Time
+	failed bool
+}
+
+type breaker struct {
+	mu       sync.Mutex
+	policy   BreakerPolicy
+	state    string
+	outcomes []outcome
+	openedAt time.Time
+	probing  bool
+	// gen counts state changes, so a result can be matched to the state
+	// its call was admitted in.
+	gen uint64
+}
+
+// ticket identifies an admitted call to record and release.
+type ticket struct {
+	gen   uint64
+	probe bool
+}
+
+func newBreaker(p BreakerPolicy) *breaker {
+	return &breaker{policy: p, state: CircuitClosed}
+}
+
+// allow reports whether a call may proceed. Once the cooldown has elapsed
+// exactly one caller is admitted as the half-open probe; every admitted caller
+// must report back through record or release with its ticket.
+func (b *breaker) allow(now time.Time) (t ticket, ok bool, retryAfter time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if wait := b.openedAt.Add(b.policy.Cooldown).Sub(now); wait > 0 {
+			return ticket{}, false, wait
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+		return ticket{gen: b.gen, probe: true}, true, 0
+	case CircuitHalfOpen:
+		if b.probing {
+			return ticket{}, false, time.Second
+		}
+		b.probing = true
+		return ticket{gen: b.gen, probe: true}, true, 0
+	}
+	return ticket{gen: b.gen}, true, 0
+}
+
+// record counts the result of the call t was issued for. Only the current
+// probe decides a half-open breaker; results of calls admitted before the
+// last state change are ignored.
+func (b *breaker) record(t ticket, now time.Time, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.gen != b.gen {
+		return
+	}
+	if t.probe {
+		b.probing = false
+		if failed {
+			b.setState(CircuitOpen)
+			b.openedAt = now
+			return
+		}
+		b.setState(CircuitClosed)
+		b.outcomes = b.outcomes[:0]
+		return
+	}
+
+	b.outcomes = append(b.outcomes, outcome{at: now, failed: failed})
+	b.prune(now)
+
+	total, failures := b.counts()
+	if total >= b.policy.MinRequests && float64(failures)/float64(total) >= b.policy.FailureRate {
+		b.setState(CircuitOpen)
+		b.openedAt = now
+		b.outcomes = b.outcomes[:0]
+	}
+}
+
+// release returns the half-open probe slot when the probe ended without a
+// verdict (e.g. the caller cancelled). Other tickets hold no slot.
+func (b *breaker) release(t ticket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.probe && t.gen == b.gen {
+		b.probing = false
+	}
+}
+
+func (b *breaker) setState(state string) {
+	b.state = state
+	b.gen++
+}
+
+func (b *breaker) prune(now time.Time) {
+	cutoff := now.Add(-b.policy.Window)
+	i := 0
+	for i < len(b.outcomes) && b.outcomes[i].at.Before(cutoff) {
+		i++
+	}
+	b.outcomes = b.outcomes[i:]
+}
+
+func (b *breaker) counts() (total, failures int) {
+	for _, o := range b.outcomes {
+		total++
+		if o.failed {
+			failures++
+		}
+	}
+	return total, failures
+}
+
+func (b *breaker) snapshot(now time.Time) CircuitSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.prune(now)
+	total, failures := b.counts()
+	s := CircuitSnapshot{State: b.state, Requests: total, Failures: failures}
+	if b.state != CircuitClosed {
+		t := b.openedAt
+		s.OpenedAt = &t
+	}
+	return s
+}
+
+// breakerFor returns the breaker for an endpoint, or nil when disabled.
+func (c *Client) breakerFor(key string) *breaker {
+	if c.breakerPolicy.FailureRate <= 0 {
+		return nil
+	}
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	b, ok := c.breakers[key]
+	if !ok {
+		b = newBreaker(c.breakerPolicy)
+		c.breakers[key] = b
+	}
+	return b
+}
+
+// Circuits returns a snapshot of every endpoint breaker seen so far.
+func (c *Client) Circuits() map[string]CircuitSnapshot {
+	c.breakersMu.Lock()
+	keys := make([]string, 0, len(c.breakers))
+	list := make([]*breaker, 0, len(c.breakers))
+	for k, b := range c.breakers {
+		keys = append(keys, k)
+		list = append(list, b)
+	}
+	c.breakersMu.Unlock()
+
+	now := time.Now()
+	out := make(map[string]CircuitSnapshot, len(keys))
+	for i, k := range keys {
+		out[k] = list[i].snapshot(now)
+	}
+	return out
+}
+
+// endpointKey groups calls by method and path shape, replacing id-like
+// segments so /assistants/{id}/users shares one breaker.
+func endpointKey(method, path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, p := range parts {
+		if looksLikeID(p) {
+			parts[i] = "{id}"
+		}
+	}
+	return method + " /" + strings.Join(parts, "/")
+}
+
+func looksLikeID(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+	for _, r := range s {
+		isHex := (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+		if !isHex && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// countsAsFailure decides whether a result should trip the breaker: transport
+// errors and 5xx responses do, client errors and caller cancellation do not.
+func countsAsFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= 500
+}
@@ -0,0 +1,131 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+)
+
+// step is one call on a breaker. op is allow, record or release; call names
+// the ticket allow handed out.
+type step struct {
+	op     string
+	call   string
+	at     time.Duration
+	failed bool
+	denied bool // allow only
+	want   string
+}
+
+func TestBreaker(t *testing.T) {
+	policy := BreakerPolicy{Window: 10 * time.Second, MinRequests: 2, FailureRate: 0.5, Cooldown: 5 * time.Second}
+	// trip admits a, b and c while closed and opens on a and b failing.
+	trip := []step{
+		{op: "allow", call: "a", want: CircuitClosed},
+		{op: "allow", call: "b", want: CircuitClosed},
+		{op: "allow", call: "c", want: CircuitClosed},
+		{op: "record", call: "a", failed: true, want: CircuitClosed},
+		{op: "record", call: "b", failed: true, want: CircuitOpen},
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "below the failure rate",
+			steps: []step{
+				{op: "allow", call: "a", want: CircuitClosed},
+				{op: "allow", call: "b", want: CircuitClosed},
+				{op: "allow", call: "c", want: CircuitClosed},
+				{op: "record", call: "a", want: CircuitClosed},
+				{op: "record", call: "b", want: CircuitClosed},
+				{op: "record", call: "c", failed: true, want: CircuitClosed},
+			},
+		},
+		{
+			name: "open until the cooldown",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "d", at: 4 * time.Second, denied: true, want: CircuitOpen},
+				step{op: "allow", call: "p", at: 5 * time.Second, want: CircuitHalfOpen},
+				step{op: "allow", call: "q", at: 5 * time.Second, denied: true, want: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "probe succeeds",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "record", call: "p", at: 6 * time.Second, want: CircuitClosed},
+				step{op: "allow", call: "q", at: 6 * time.Second, want: CircuitClosed},
+			),
+		},
+		{
+			name: "probe fails",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "record", call: "p", at: 6 * time.Second, failed: true, want: CircuitOpen},
+				step{op: "allow", call: "q", at: 10 * time.Second, denied: true, want: CircuitOpen},
+				step{op: "allow", call: "r", at: 11 * time.Second, want: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "stale result while open",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "record", call: "c", want: CircuitOpen},
+			),
+		},
+		{
+			name: "stale result while half-open",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "record", call: "c", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "allow", call: "q", at: 6 * time.Second, denied: true, want: CircuitHalfOpen},
+				step{op: "record", call: "p", at: 7 * time.Second, failed: true, want: CircuitOpen},
+			),
+		},
+		{
+			name: "stale failure after closing",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "record", call: "p", at: 6 * time.Second, want: CircuitClosed},
+				step{op: "record", call: "c", at: 6 * time.Second, failed: true, want: CircuitClosed},
+				step{op: "allow", call: "d", at: 6 * time.Second, want: CircuitClosed},
+				step{op: "record", call: "d", at: 6 * time.Second, failed: true, want: CircuitClosed},
+			),
+		},
+		{
+			name: "stale release",
+			steps: append(trip[:len(trip):len(trip)],
+				step{op: "allow", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "release", call: "c", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "allow", call: "q", at: 6 * time.Second, denied: true, want: CircuitHalfOpen},
+				step{op: "release", call: "p", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "allow", call: "r", at: 6 * time.Second, want: CircuitHalfOpen},
+				step{op: "record", call: "r", at: 6 * time.Second, want: CircuitClosed},
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			b := newBreaker(policy)
+			tickets := map[string]ticket{}
+			for i, s := range tt.steps {
+				now := start.Add(s.at)
+				switch s.op {
+				case "allow":
+					tk, ok, _ := b.allow(now)
+					if ok == s.denied {
+						t.Fatalf("step %d: allow %s = %v, want %v", i, s.call, ok, !s.denied)
+					}
+					tickets[s.call] = tk
+				case "record":
+					b.record(tickets[s.call], now, s.failed)
+				case "release":
+					b.release(tickets[s.call])
+				}
+				if got := b.snapshot(now).State; got != s.want {
+					t.Fatalf("step %d: %s %s left the breaker %s, want %s", i, s.op, s.call, got, s.want)
+				}
+			}
+		})
+	}
+}
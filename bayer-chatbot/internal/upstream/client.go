@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"bayer-chatbot-service/internal/logger"
+	"bayer-chatbot-service/internal/metrics"
+	"bayer-chatbot-service/internal/tracing"
 )
 
 type Options struct {
@@ -20,15 +23,32 @@ type Options struct {
 	DebugUpstream bool
 	Logger        *logger.Logger
 	Timeout       time.Duration
+	Retry         RetryPolicy
+	Breaker       BreakerPolicy
+	// TokenMode is one of the TokenMode constants; empty means service.
+	TokenMode string
+	// Metrics receives per-endpoint latency and error metrics when set.
+	Metrics *metrics.Registry
+	// Tracer records a client span per attempt; the caller's trace context
+	// is forwarded either way.
+	Tracer *tracing.Tracer
 }
 
 type Client struct {
 	baseURL     string
 	accessToken string
 	project     string
+	tokenMode   string
 	debug       bool
 	logr        *logger.Logger
 	httpClient  *http.Client
+	retry       RetryPolicy
+	metrics     *clientMetrics
+	tracer      *tracing.Tracer
+
+	breakerPolicy BreakerPolicy
+	breakersMu    sync.Mutex
+	breakers      map[string]*breaker
 }
 
 func NewClient(opts Options) *Client {
@@ -37,9 +57,16 @@ func NewClient(opts Options) *Client {
 		baseURL:     base,
 		accessToken: opts.AccessToken,
 		project:     opts.Project,
+		tokenMode:   opts.TokenMode,
 		debug:       opts.DebugUpstream,
 		logr:        opts.Logger,
 		httpClient:  &http.Client{Timeout: opts.Timeout},
+		retry:       opts.Retry,
+		metrics:     newClientMetrics(opts.Metrics),
+		tracer:      opts.Tracer,
+
+		breakerPolicy: opts.Breaker,
+		breakers:      map[string]*breaker{},
 	}
 }
 
@@ -55,29 +82,24 @@ func (c *Client) URL(path string) (string, error) {
 }
 
 func (c *Client) DoJSON(ctx context.Context, method, path string, query url.Values, body []byte, requestID string) (*http.Response, []byte, error) {
+	return c.doJSON(ctx, endpointKey(method, path), method, path, query, body, requestID)
+}
+
+// doJSON is DoJSON with an explicit endpoint key for the breaker and
+// metrics, for paths whose IDs endpointKey cannot recognise.
+func (c *Client) doJSON(ctx context.Context, endpoint, method, path string, query url.Values, body []byte, requestID string) (*http.Response, []byte, error) {
 	u, err := c.URL(path)
 	if err != nil {
 		return nil, nil, err
 	}
-	if query != nil {
+	if len(query) > 0 {
 		u = u + "?" + query.Encode()
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
-	if err != nil {
-		return nil, nil, err
-	}
-	c.applyHeaders(req, requestID)
-	req.Header.Set("accept", "application/json")
-	if body != nil {
-		req.Header.Set("content-type", "application/json")
-	}
-
-	c.logRequest(req)
-
-	res, err := c.httpClient.Do(req)
+	// Only idempotent reads are retried; a retried POST could run twice.
+	res, req, err := c.send(ctx, endpoint, method, u, body, requestID, "application/json", method == http.MethodGet)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, wrapSendError(err)
 	}
 	defer res.Body.Close()
 
@@ -85,12 +107,18 @@ func (c *Client) DoJSON(ctx context.Context, method, path string, query url.Valu
 	c.logResponse(req, res, data)
 
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		return res, data, errors.New("upstream error")
+		return res, data, newStatusError(res, data)
 	}
 
 	ct := res.Header.Get("content-type")
 	if ct != "" && !strings.Contains(ct, "application/json") {
-		return res, data, errors.New("unexpected content-type: " + ct)
+		return res, data, &Error{
+			Status:    res.StatusCode,
+			Code:      CodeBadResponse,
+			Message:   "unexpected content-type: " + ct,
+			RequestID: responseRequestID(res),
+			Body:      excerpt(data),
+		}
 	}
 
 	return res, data, nil
@@ -101,38 +129,134 @@ func (c *Client) DoSSE(ctx context.Context, path string, query url.Values, body
 	if err != nil {
 		return nil, err
 	}
-	if query != nil {
+	if len(query) > 0 {
 		u = u + "?" + query.Encode()
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	// Retries are safe here because nothing has been relayed to the caller
+	// until a successful response is returned.
+	res, req, err := c.send(ctx, endpointKey(http.MethodPost, path), http.MethodPost, u, body, requestID, "text/event-stream", true)
 	if err != nil {
-		return nil, err
-	}
-	c.applyHeaders(req, requestID)
-	req.Header.Set("accept", "text/event-stream")
-	req.Header.Set("content-type", "application/json")
-
-	c.logRequest(req)
-
-	res, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+		return nil, wrapSendError(err)
 	}
 
 	if res.StatusCode < 200 || res.StatusCode >= 300 {
 		b, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
 		_ = res.Body.Close()
 		c.logResponse(req, res, b)
-		return nil, errors.New(res.Status)
+		return nil, newStatusError(res, b)
 	}
 
 	c.logResponse(req, res, nil)
 	return res, nil
 }
 
-func (c *Client) applyHeaders(req *http.Request, requestID string) {
-	req.Header.Set("x-baychatgpt-accesstoken", c.accessToken)
+// send performs the request, retrying network errors and retryable statuses
+// according to the client's RetryPolicy when retry is true. Every attempt
+// passes through the endpoint's circuit breaker. The returned request is the
+// one that produced res, for logging.
+func (c *Client) send(ctx context.Context, endpoint, method, u string, body []byte, requestID, accept string, retry bool) (*http.Response, *http.Request, error) {
+	maxAttempts := 1
+	if retry && c.retry.MaxAttempts > 1 {
+		maxAttempts = c.retry.MaxAttempts
+	}
+
+	token, err := c.tokenFor(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	br := c.breakerFor(endpoint)
+
+	for attempt := 1; ; attempt++ {
+		var admitted ticket
+		if br != nil {
+			var ok bool
+			var wait time.Duration
+			if admitted, ok, wait = br.allow(time.Now()); !ok {
+				c.metrics.rejected(endpoint, "circuit_open")
+				return nil, nil, &CircuitOpenError{Endpoint: endpoint, RetryAfter: wait}
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+		if err != nil {
+			if br != nil {
+				br.release(admitted)
+			}
+			return nil, nil, err
+		}
+		c.applyHeaders(req, token, requestID)
+		req.Header.Set("accept", accept)
+		if body != nil {
+			req.Header.Set("content-type", "application/json")
+		}
+		spanCtx, span := c.tracer.Start(ctx, "upstream "+endpoint, tracing.KindClient)
+		tracing.Inject(spanCtx, req.Header)
+
+		c.logRequest(req)
+
+		sent := time.Now()
+		res, err := c.httpClient.Do(req)
+		c.metrics.observe(endpoint, res, err, time.Since(sent))
+		endAttemptSpan(span, req, attempt, res, err)
+		reportAttempts(ctx, attempt)
+		if br != nil {
+			if err != nil && ctx.Err() != nil {
+				// The caller gave up; that says nothing about upstream health.
+				br.release(admitted)
+			} else {
+				br.record(admitted, time.Now(), countsAsFailure(res, err))
+			}
+		}
+		if attempt >= maxAttempts || ctx.Err() != nil {
+			return res, req, err
+		}
+
+		delay := c.retry.backoff(attempt)
+		fields := map[string]interface{}{
+			"method":  method,
+			"url":     req.URL.String(),
+			"attempt": attempt,
+		}
+		if err != nil {
+			fields["error"] = err.Error()
+		} else {
+			if !retryableStatus(res.StatusCode) {
+				return res, req, nil
+			}
+			if ra, ok := parseRetryAfter(res.Header.Get("retry-after")); ok {
+				if c.retry.MaxDelay > 0 && ra > c.retry.MaxDelay {
+					// The upstream asks for a longer pause than we are willing to hold the caller.
+					return res, req, nil
+				}
+				delay = ra
+			}
+			b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+			_ = res.Body.Close()
+			c.logResponse(req, res, b)
+			fields["status"] = res.StatusCode
+		}
+		fields["delayMs"] = delay.Milliseconds()
+		c.logr.Ctx(ctx).Warn("upstream.retry", fields)
+
+		if err := sleepCtx(ctx, delay); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// wrapSendError converts transport failures into *Error. Local rejections
+// (circuit open, missing token) are returned unchanged.
+func wrapSendError(err error) error {
+	if isLocalError(err) {
+		return err
+	}
+	return newTransportError(err)
+}
+
+func (c *Client) applyHeaders(req *http.Request, token, requestID string) {
+	req.Header.Set("x-baychatgpt-accesstoken", token)
 	if c.project != "" {
 		req.Header.Set("mga-project", c.project)
 	}
@@ -155,7 +279,7 @@ func (c *Client) logRequest(req *http.Request) {
 		safeHeaders[k] = strings.Join(v, ",")
 	}
 
-	c.logr.Debug("upstream.request", map[string]interface{}{
+	c.logr.Ctx(req.Context()).Debug("upstream.request", map[string]interface{}{
 		"method":  req.Method,
 		"url":     req.URL.String(),
 		"headers": safeHeaders,
@@ -175,5 +299,21 @@ func (c *Client) logResponse(req *http.Request, res *http.Response, bodyPreview
 	if len(bodyPreview) > 0 {
 		fields["bodyPreview"] = string(bodyPreview)
 	}
-	c.logr.Debug("upstream.response", fields)
+	c.logr.Ctx(req.Context()).Debug("upstream.response", fields)
+}
+
+func endAttemptSpan(span *tracing.Span, req *http.Request, attempt int, res *http.Response, err error) {
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.String())
+	span.SetAttribute("upstream.attempt", attempt)
+	switch {
+	case err != nil:
+		span.SetError(err.Error())
+	default:
+		span.SetAttribute("http.response.status_code", res.StatusCode)
+		if res.StatusCode >= 500 {
+			span.SetError(res.Status)
+		}
+	}
+	span.End()
 }
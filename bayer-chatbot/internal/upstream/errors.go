@@ -0,0 +1,163 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error codes set on *Error.
+const (
+	CodeBadRequest    = "bad_request"
+	CodeUnauthorized  = "unauthorized"
+	CodeForbidden     = "forbidden"
+	CodeNotFound      = "not_found"
+	CodeUnprocessable = "unprocessable_entity"
+	CodeRateLimited   = "rate_limited"
+	CodeServerError   = "server_error"
+	CodeTimeout       = "timeout"
+	CodeUnreachable   = "unreachable"
+	CodeCanceled      = "canceled"
+	CodeBadResponse   = "bad_response"
+	CodeMissingToken  = "missing_token"
+)
+
+const bodyExcerptLimit = 1024
+
+// Error describes a failed upstream call. Status is 0 when no response was
+// received (transport failure, timeout, cancellation).
+type Error struct {
+	Status     int
+	Code       string
+	Message    string
+	Retryable  bool
+	RequestID  string
+	Body       string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	if e.Status > 0 {
+		return "upstream " + http.StatusText(e.Status) + ": " + e.Message
+	}
+	return "upstream " + e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newStatusError builds an *Error from a non-2xx response and its body.
+func newStatusError(res *http.Response, body []byte) *Error {
+	e := &Error{
+		Status:    res.StatusCode,
+		Code:      codeForStatus(res.StatusCode),
+		Message:   messageFromBody(body),
+		Retryable: retryableStatus(res.StatusCode),
+		RequestID: responseRequestID(res),
+		Body:      excerpt(body),
+	}
+	if e.Message == "" {
+		e.Message = res.Status
+	}
+	if ra, ok := parseRetryAfter(res.Header.Get("retry-after")); ok {
+		e.RetryAfter = ra
+	}
+	return e
+}
+
+// newTransportError wraps an error returned before any response arrived.
+func newTransportError(err error) *Error {
+	e := &Error{Code: CodeUnreachable, Message: err.Error(), Retryable: true, Err: err}
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		e.Code = CodeCanceled
+		e.Retryable = false
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		e.Code = CodeTimeout
+	}
+	return e
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 500 {
+		return CodeServerError
+	}
+	return CodeBadResponse
+}
+
+// messageFromBody extracts a human-readable message from common error bodies:
+// {"detail": "..."}, {"detail": [{"msg": "..."}]}, {"message": "..."} and
+// {"error": "..." | {"message": "..."}}.
+func messageFromBody(body []byte) string {
+	var m map[string]interface{}
+	if json.Unmarshal(body, &m) != nil {
+		return ""
+	}
+	switch d := m["detail"].(type) {
+	case string:
+		return d
+	case []interface{}:
+		msgs := make([]string, 0, len(d))
+		for _, raw := range d {
+			if item, ok := raw.(map[string]interface{}); ok {
+				if s, ok := item["msg"].(string); ok {
+					msgs = append(msgs, s)
+				}
+			}
+		}
+		if len(msgs) > 0 {
+			return strings.Join(msgs, "; ")
+		}
+	}
+	if s, ok := m["message"].(string); ok {
+		return s
+	}
+	switch e := m["error"].(type) {
+	case string:
+		return e
+	case map[string]interface{}:
+		if s, ok := e["message"].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func responseRequestID(res *http.Response) string {
+	for _, h := range []string{"x-request-id", "x-correlation-id", "x-amzn-requestid"} {
+		if v := res.Header.Get(h); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func excerpt(body []byte) string {
+	if len(body) > bodyExcerptLimit {
+		return string(body[:bodyExcerptLimit])
+	}
+	return string(body)
+}
@@ -0,0 +1,52 @@
+package upstream
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"bayer-chatbot-service/internal/metrics"
+)
+
+// clientMetrics are recorded per attempt, keyed by endpointKey.
+type clientMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+func newClientMetrics(reg *metrics.Registry) *clientMetrics {
+	if reg == nil {
+		return nil
+	}
+	return &clientMetrics{
+		requests: reg.Counter("upstream_requests_total", "Upstream attempts by endpoint and status (0 when no response arrived).", "endpoint", "status"),
+		duration: reg.Histogram("upstream_request_duration_seconds", "Time until upstream response headers, by endpoint.", nil, "endpoint"),
+		errors:   reg.Counter("upstream_errors_total", "Failed upstream attempts by endpoint and error code.", "endpoint", "code"),
+	}
+}
+
+func (m *clientMetrics) observe(endpoint string, res *http.Response, err error, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	m.requests.Inc(endpoint, strconv.Itoa(status))
+	m.duration.Observe(elapsed.Seconds(), endpoint)
+	switch {
+	case err != nil:
+		m.errors.Inc(endpoint, newTransportError(err).Code)
+	case status < 200 || status >= 300:
+		m.errors.Inc(endpoint, codeForStatus(status))
+	}
+}
+
+func (m *clientMetrics) rejected(endpoint, code string) {
+	if m == nil {
+		return
+	}
+	m.errors.Inc(endpoint, code)
+}
@@ -0,0 +1,44 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrNoServiceToken is returned by Ping when there is no service-wide token
+// to probe with, as in passthrough mode.
+var ErrNoServiceToken = errors.New("no service access token configured")
+
+// HasServiceToken reports whether a service-wide access token is configured.
+func (c *Client) HasServiceToken() bool {
+	return c.accessToken != ""
+}
+
+// Ping makes a single GET /models call with the service token to check that
+// the upstream is reachable and accepts the token. It is not retried, but it
+// does pass through (and feed) the endpoint's circuit breaker.
+func (c *Client) Ping(ctx context.Context) error {
+	if c.accessToken == "" {
+		return ErrNoServiceToken
+	}
+	u, err := c.URL("/models")
+	if err != nil {
+		return err
+	}
+	// Passthrough modes prefer a caller token; hand them the service token.
+	ctx = WithCallerToken(ctx, c.accessToken)
+	res, req, err := c.send(ctx, endpointKey(http.MethodGet, "/models"), http.MethodGet, u, nil, "", "application/json", false)
+	if err != nil {
+		return wrapSendError(err)
+	}
+	defer res.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	c.logResponse(req, res, data)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return newStatusError(res, data)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package upstream
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AttemptsHeader is the response header that reports how many upstream
+// attempts a request needed.
+const AttemptsHeader = "x-upstream-attempts"
+
+// RetryPolicy controls retries of idempotent calls and of the pre-first-byte
+// phase of streams. MaxAttempts includes the first attempt; values below 2
+// disable retries. Jitter is the fraction (0..1) of each delay that is
+// randomized.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	// MaxDelay 0 means no limit; doubling still stops short of overflow.
+	for i := 1; i < attempt && d < math.MaxInt64/2; i++ {
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	j := p.Jitter
+	if j <= 0 {
+		return d
+	}
+	if j > 1 {
+		j = 1
+	}
+	fixed := time.Duration(float64(d) * (1 - j))
+	return fixed + time.Duration(rand.Float64()*float64(d)*j)
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter understands both delta-seconds and HTTP-date values.
+func parseRetryAfter(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+type attemptsReporterKey struct{}
+
+// WithAttemptsReporter returns a context whose upstream calls report their
+// attempt count to fn. The HTTP layer uses it to set AttemptsHeader.
+func WithAttemptsReporter(ctx context.Context, fn func(attempts int)) context.Context {
+	return context.WithValue(ctx, attemptsReporterKey{}, fn)
+}
+
+func reportAttempts(ctx context.Context, attempts int) {
+	if fn, ok := ctx.Value(attemptsReporterKey{}).(func(int)); ok && fn != nil {
+		fn(attempts)
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
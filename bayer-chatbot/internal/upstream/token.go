@@ -0,0 +1,68 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+)
+
+// Token modes select which x-baychatgpt-accesstoken is sent upstream.
+const (
+	// TokenModeService always sends the service-wide access token.
+	TokenModeService = "service"
+	// TokenModePassthrough sends the caller's own token and fails without one.
+	TokenModePassthrough = "passthrough"
+	// TokenModePassthroughWithFallback prefers the caller's token and falls
+	// back to the service token.
+	TokenModePassthroughWithFallback = "passthrough-with-fallback"
+)
+
+// ValidTokenMode reports whether mode is one of the TokenMode constants.
+func ValidTokenMode(mode string) bool {
+	switch mode {
+	case TokenModeService, TokenModePassthrough, TokenModePassthroughWithFallback:
+		return true
+	}
+	return false
+}
+
+type callerTokenKey struct{}
+
+// WithCallerToken attaches the inbound caller's upstream token to ctx.
+func WithCallerToken(ctx context.Context, token string) context.Context {
+	if token == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, callerTokenKey{}, token)
+}
+
+// CallerToken returns the token attached by WithCallerToken, if any.
+func CallerToken(ctx context.Context) string {
+	s, _ := ctx.Value(callerTokenKey{}).(string)
+	return s
+}
+
+// tokenFor picks the access token for a call according to the token mode.
+func (c *Client) tokenFor(ctx context.Context) (string, error) {
+	switch c.tokenMode {
+	case TokenModePassthrough:
+		if t := CallerToken(ctx); t != "" {
+			return t, nil
+		}
+		return "", &Error{Code: CodeMissingToken, Message: "a caller access token is required"}
+	case TokenModePassthroughWithFallback:
+		if t := CallerToken(ctx); t != "" {
+			return t, nil
+		}
+	}
+	if c.accessToken == "" {
+		return "", &Error{Code: CodeMissingToken, Message: "no upstream access token configured"}
+	}
+	return c.accessToken, nil
+}
+
+// isLocalError reports errors produced before any upstream contact, which
+// must not be wrapped as transport failures.
+func isLocalError(err error) bool {
+	var e *Error
+	return errors.As(err, &e) || errors.Is(err, ErrCircuitOpen)
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldError reports one problem with one field of a request body. Field is
+// a path such as "messages[2].role".
+type FieldError struct {
+	Field   string `json:"field"`
+	Problem string `json:"problem"`
+}
+
+// ReadBody reads at most maxBytes of the request body.
+func ReadBody(r *http.Request, maxBytes int64) ([]byte, error) {
+	if r.Body == nil {
+		return nil, errors.New("missing request body")
+	}
+	defer r.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > maxBytes {
+		return nil, errors.New("request body exceeds " + strconv.FormatInt(maxBytes, 10) + " bytes")
+	}
+	return b, nil
+}
+
+// DecodeStrict decodes a JSON object into the struct pointed to by dst. It
+// does not stop at the first problem: every unknown field and every value of
+// the wrong type is reported, with its path. The returned error is only set
+// when data is not a JSON object at all.
+func DecodeStrict(data []byte, dst interface{}) ([]FieldError, error) {
+	return decodeChecked(data, dst, false)
+}
+
+// DecodeTyped is DecodeStrict without the unknown-field check, for bodies
+// whose clients are known to send extra parameters.
+func DecodeTyped(data []byte, dst interface{}) ([]FieldError, error) {
+	return decodeChecked(data, dst, true)
+}
+
+func decodeChecked(data []byte, dst interface{}, allowUnknown bool) ([]FieldError, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, errors.New("missing request body")
+	}
+	if !json.Valid(data) {
+		// Let encoding/json describe the syntax error.
+		var discard interface{}
+		if err := json.Unmarshal(data, &discard); err != nil {
+			return nil, err
+		}
+	}
+	if data[0] != '{' {
+		return nil, errors.New("request body must be a JSON object")
+	}
+	d := decoder{allowUnknown: allowUnknown}
+	d.value(data, reflect.ValueOf(dst).Elem(), "")
+	return d.errs, nil
+}
+
+type decoder struct {
+	allowUnknown bool
+	errs         []FieldError
+}
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage(nil))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+func (d *decoder) fail(path, problem string) {
+	d.errs = append(d.errs, FieldError{Field: path, Problem: problem})
+}
+
+func (d *decoder) value(raw []byte, v reflect.Value, path string) {
+	if v.Type() == rawMessageType || v.Kind() == reflect.Interface {
+		_ = json.Unmarshal(raw, v.Addr().Interface())
+		return
+	}
+	if string(raw) == "null" {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		d.value(raw, v.Elem(), path)
+		return
+	}
+	if reflect.PtrTo(v.Type()).Implements(unmarshalerType) {
+		if err := json.Unmarshal(raw, v.Addr().Interface()); err != nil {
+			d.fail(path, "is not valid")
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(raw, &obj) != nil {
+			d.fail(path, "must be an object")
+			return
+		}
+		d.object(obj, v, path)
+	case reflect.Slice:
+		var items []json.RawMessage
+		if json.Unmarshal(raw, &items) != nil {
+			d.fail(path, "must be an array")
+			return
+		}
+		s := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			d.value(item, s.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+		v.Set(s)
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if v.Type().Key().Kind() != reflect.String || json.Unmarshal(raw, &obj) != nil {
+			d.fail(path, "must be an object")
+			return
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(obj))
+		for _, k := range sortedRawKeys(obj) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			d.value(obj[k], elem, joinPath(path, k))
+			m.SetMapIndex(reflect.ValueOf(k), elem)
+		}
+		v.Set(m)
+	default:
+		if json.Unmarshal(raw, v.Addr().Interface()) != nil {
+			d.fail(path, typeProblem(v.Kind()))
+		}
+	}
+}
+
+// object decodes the known fields in declaration order, then reports the
+// unknown ones sorted by name.
+func (d *decoder) object(obj map[string]json.RawMessage, v reflect.Value, path string) {
+	t := v.Type()
+	seen := make(map[string]bool, len(obj))
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+		raw, present := obj[name]
+		if !present {
+			continue
+		}
+		seen[name] = true
+		d.value(raw, v.Field(i), joinPath(path, name))
+	}
+	if d.allowUnknown {
+		return
+	}
+	for _, k := range sortedRawKeys(obj) {
+		if !seen[k] {
+			d.fail(joinPath(path, k), "is not a known field")
+		}
+	}
+}
+
+func jsonName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag == "" {
+		return f.Name, true
+	}
+	return tag, true
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func sortedRawKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func typeProblem(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return "must be a string"
+	case reflect.Bool:
+		return "must be a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "must be an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "must be a number"
+	}
+	return "has the wrong type"
+}
@@ -2,8 +2,6 @@ package utils
 
 import (
 	"encoding/json"
-	"errors"
-	"io"
 	"net/http"
 )
 
@@ -12,16 +10,3 @@ func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
-
-func ReadJSON(r *http.Request, dst interface{}, maxBytes int64) error {
-	if r.Body == nil {
-		return errors.New("missing request body")
-	}
-	defer r.Body.Close()
-
-	dec := json.NewDecoder(io.LimitReader(r.Body, maxBytes))
-	if err := dec.Decode(dst); err != nil {
-		return err
-	}
-	return nil
-}
@@ -2,8 +2,12 @@ package utils
 
 import (
 	"bufio"
+	"context"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 // FlushWriter ensures each write is flushed for streaming responses.
@@ -35,3 +39,236 @@ func CopyAndFlush(dst http.ResponseWriter, src io.Reader) error {
 	_ = bw.Flush()
 	return err
 }
+
+// SSEEvent is a single server-sent event. Data holds the joined data lines.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// ReadSSE parses an event stream and calls fn for every dispatched event.
+// Comment lines are skipped. It stops at EOF or when fn returns an error.
+func ReadSSE(src io.Reader, fn func(SSEEvent) error) error {
+	br := bufio.NewReaderSize(src, 64*1024)
+	var ev SSEEvent
+	var data []string
+	dispatch := func() error {
+		if len(data) == 0 && ev.Event == "" {
+			ev = SSEEvent{}
+			return nil
+		}
+		ev.Data = strings.Join(data, "\n")
+		out := ev
+		ev = SSEEvent{}
+		data = data[:0]
+		return fn(out)
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				if derr := dispatch(); derr != nil {
+					return derr
+				}
+			} else if !strings.HasPrefix(line, ":") {
+				field, value := line, ""
+				if idx := strings.Index(line, ":"); idx >= 0 {
+					field = line[:idx]
+					value = strings.TrimPrefix(line[idx+1:], " ")
+				}
+				switch field {
+				case "data":
+					data = append(data, value)
+				case "event":
+					ev.Event = value
+				case "id":
+					ev.ID = value
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				// A trailing event without a blank line is still delivered.
+				return dispatch()
+			}
+			return err
+		}
+	}
+}
+
+// WriteSSE writes one event and flushes it to the client when possible.
+func WriteSSE(w io.Writer, ev SSEEvent) error {
+	var b strings.Builder
+	if ev.ID != "" {
+		b.WriteString("id: " + ev.ID + "\n")
+	}
+	if ev.Event != "" {
+		b.WriteString("event: " + ev.Event + "\n")
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// SetSSEHeaders prepares a response for event streaming.
+func SetSSEHeaders(w http.ResponseWriter) {
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache, no-transform")
+	w.Header().Set("connection", "keep-alive")
+}
+
+// WritePing writes a ": ping" comment. Clients ignore comments; proxies see
+// traffic and keep the connection open.
+func WritePing(w io.Writer) error {
+	if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// StreamTimeouts bound the wait for upstream bytes. Zero disables each.
+type StreamTimeouts struct {
+	// Heartbeat is how often ping runs while no upstream bytes arrive.
+	Heartbeat time.Duration
+	// MaxIdle is the longest allowed gap between upstream bytes.
+	MaxIdle time.Duration
+}
+
+// IdleError is returned by a watched stream whose upstream went quiet for
+// longer than StreamTimeouts.MaxIdle.
+type IdleError struct {
+	After time.Duration
+}
+
+func (e *IdleError) Error() string {
+	return "upstream sent nothing for " + e.After.String()
+}
+
+// WatchStream wraps an upstream body. While a Read waits for bytes, ping is
+// called every t.Heartbeat; a gap longer than t.MaxIdle fails the Read with
+// *IdleError, and a done ctx fails it with ctx.Err(). Either way src is
+// closed so the upstream request is released. A ping error is returned from
+// Read, which ends relays whose client has gone.
+func WatchStream(ctx context.Context, src io.ReadCloser, t StreamTimeouts, ping func() error) io.ReadCloser {
+	if t.Heartbeat <= 0 && t.MaxIdle <= 0 && ctx.Done() == nil {
+		return src
+	}
+	ws := &watchedStream{
+		ctx:    ctx,
+		src:    src,
+		t:      t,
+		ping:   ping,
+		chunks: make(chan watchedChunk),
+		stop:   make(chan struct{}),
+	}
+	go ws.pump()
+	return ws
+}
+
+type watchedChunk struct {
+	b   []byte
+	err error
+}
+
+type watchedStream struct {
+	ctx  context.Context
+	src  io.ReadCloser
+	t    StreamTimeouts
+	ping func() error
+
+	chunks  chan watchedChunk
+	pending []byte
+	err     error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// pump reads src on its own goroutine so Read can wait with timers.
+func (ws *watchedStream) pump() {
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := ws.src.Read(buf)
+		select {
+		case ws.chunks <- watchedChunk{b: buf[:n], err: err}:
+		case <-ws.stop:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ws *watchedStream) Read(p []byte) (int, error) {
+	if len(ws.pending) > 0 {
+		n := copy(p, ws.pending)
+		ws.pending = ws.pending[n:]
+		return n, nil
+	}
+	if ws.err != nil {
+		return 0, ws.err
+	}
+
+	var heartbeat, idle <-chan time.Time
+	if ws.t.Heartbeat > 0 && ws.ping != nil {
+		ticker := time.NewTicker(ws.t.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+	if ws.t.MaxIdle > 0 {
+		timer := time.NewTimer(ws.t.MaxIdle)
+		defer timer.Stop()
+		idle = timer.C
+	}
+
+	for {
+		select {
+		case c := <-ws.chunks:
+			ws.err = c.err
+			n := copy(p, c.b)
+			ws.pending = c.b[n:]
+			if n == 0 && ws.err != nil {
+				return 0, ws.err
+			}
+			return n, nil
+		case <-heartbeat:
+			if err := ws.ping(); err != nil {
+				return 0, ws.fail(err)
+			}
+		case <-idle:
+			return 0, ws.fail(&IdleError{After: ws.t.MaxIdle})
+		case <-ws.ctx.Done():
+			return 0, ws.fail(ws.ctx.Err())
+		}
+	}
+}
+
+func (ws *watchedStream) fail(err error) error {
+	ws.err = err
+	_ = ws.Close()
+	return err
+}
+
+func (ws *watchedStream) Close() error {
+	var err error
+	ws.stopOnce.Do(func() {
+		close(ws.stop)
+		err = ws.src.Close()
+	})
+	return err
+}
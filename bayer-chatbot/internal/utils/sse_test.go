@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// chunk is written to the upstream side after Wait.
+type chunk struct {
+	Wait time.Duration
+	Data string
+}
+
+func TestWatchStream(t *testing.T) {
+	errPing := errors.New("client gone")
+	tests := []struct {
+		name      string
+		timeouts  StreamTimeouts
+		chunks    []chunk
+		pingErr   error
+		cancel    time.Duration // cancels ctx after this long; zero never
+		want      string
+		wantErr   func(error) bool
+		minPings  int64
+		maxPings  int64 // -1 for no bound
+		srcClosed bool
+	}{
+		{
+			name:     "fast upstream",
+			timeouts: StreamTimeouts{Heartbeat: 50 * time.Millisecond, MaxIdle: time.Second},
+			chunks:   []chunk{{0, "a"}, {0, "b"}},
+			want:     "ab",
+			maxPings: 0,
+		},
+		{
+			name:     "heartbeats while quiet",
+			timeouts: StreamTimeouts{Heartbeat: 10 * time.Millisecond, MaxIdle: time.Second},
+			chunks:   []chunk{{80 * time.Millisecond, "late"}},
+			want:     "late",
+			minPings: 3,
+			maxPings: -1,
+		},
+		{
+			name:     "idle limit resets on every read",
+			timeouts: StreamTimeouts{MaxIdle: 80 * time.Millisecond},
+			chunks:   []chunk{{40 * time.Millisecond, "a"}, {40 * time.Millisecond, "b"}, {40 * time.Millisecond, "c"}},
+			want:     "abc",
+		},
+		{
+			name:     "idle limit",
+			timeouts: StreamTimeouts{Heartbeat: 10 * time.Millisecond, MaxIdle: 50 * time.Millisecond},
+			chunks:   []chunk{{0, "a"}, {time.Second, "never"}},
+			want:     "a",
+			wantErr: func(err error) bool {
+				var idle *IdleError
+				return errors.As(err, &idle) && idle.After == 50*time.Millisecond
+			},
+			minPings:  2,
+			maxPings:  -1,
+			srcClosed: true,
+		},
+		{
+			name:      "ping failure",
+			timeouts:  StreamTimeouts{Heartbeat: 10 * time.Millisecond},
+			chunks:    []chunk{{time.Second, "never"}},
+			pingErr:   errPing,
+			wantErr:   func(err error) bool { return err == errPing },
+			minPings:  1,
+			maxPings:  1,
+			srcClosed: true,
+		},
+		{
+			name:      "canceled",
+			chunks:    []chunk{{0, "a"}, {time.Second, "never"}},
+			cancel:    30 * time.Millisecond,
+			want:      "a",
+			wantErr:   func(err error) bool { return errors.Is(err, context.Canceled) },
+			srcClosed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr, pw := io.Pipe()
+			go func() {
+				for _, c := range tt.chunks {
+					time.Sleep(c.Wait)
+					if _, err := pw.Write([]byte(c.Data)); err != nil {
+						return
+					}
+				}
+				pw.Close()
+			}()
+
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				time.AfterFunc(tt.cancel, cancel)
+			}
+			var pings atomic.Int64
+			ping := func() error {
+				pings.Add(1)
+				return tt.pingErr
+			}
+
+			body := WatchStream(ctx, pr, tt.timeouts, ping)
+			got, err := io.ReadAll(body)
+			if string(got) != tt.want {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("error = %v, want none", err)
+			case tt.wantErr != nil && !tt.wantErr(err):
+				t.Errorf("unexpected error %v", err)
+			}
+			if n := pings.Load(); n < tt.minPings || tt.maxPings >= 0 && n > tt.maxPings {
+				t.Errorf("%d pings, want %d..%d", n, tt.minPings, tt.maxPings)
+			}
+			if tt.srcClosed {
+				if _, err := pw.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+					t.Errorf("upstream not closed: write = %v", err)
+				}
+				if _, again := body.Read(make([]byte, 1)); again != err {
+					t.Errorf("second Read = %v, want %v", again, err)
+				}
+			}
+		})
+	}
+}
+
+func TestWatchStreamPassthrough(t *testing.T) {
+	pr, _ := io.Pipe()
+	if got := WatchStream(context.Background(), pr, StreamTimeouts{}, nil); got != io.ReadCloser(pr) {
+		t.Error("WatchStream wrapped a body it has nothing to watch for")
+	}
+}
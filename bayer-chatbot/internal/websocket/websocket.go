@@ -0,0 +1,344 @@
+// Package websocket is a small RFC 6455 server on the standard library: the
+// upgrade handshake, text and binary messages with fragmentation, and
+// ping/pong/close control frames. Extensions and subprotocols are not
+// negotiated.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Opcodes used by this package.
+const (
+	opContinuation = 0x0
+	OpText         = 0x1
+	OpBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes sent by this package.
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooLarge      = 1009
+)
+
+// acceptGUID is appended to the client key to derive Sec-WebSocket-Accept.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrOrigin is returned by Upgrade, before the connection is taken over,
+// when Options.CheckOrigin refuses the request.
+var ErrOrigin = errors.New("websocket handshake: origin not allowed")
+
+// HandshakeError is returned by Upgrade before the connection is taken over,
+// so the caller can still answer with a normal HTTP error.
+type HandshakeError struct {
+	Message string
+}
+
+func (e *HandshakeError) Error() string { return "websocket handshake: " + e.Message }
+
+// CloseError is returned by ReadMessage once the peer sent a close frame or
+// the connection was closed for a protocol violation.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	msg := "websocket closed with code " + strconv.Itoa(e.Code)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+type Options struct {
+	// MaxMessage bounds a reassembled message; larger ones close the
+	// connection with 1009. Default 1 MiB.
+	MaxMessage int64
+	// WriteTimeout bounds each frame write. Default 10s.
+	WriteTimeout time.Duration
+	// CheckOrigin reports whether the request's Origin may connect. By
+	// default requests without Origin and same-host origins are allowed.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Conn is an upgraded connection. Reads must come from one goroutine;
+// writes are safe from any number.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	opts Options
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// Upgrade validates the handshake in r, takes over the connection through
+// http.ResponseController and answers 101. Headers already set on w, such
+// as x-request-id, are sent with the 101.
+func Upgrade(w http.ResponseWriter, r *http.Request, opts Options) (*Conn, error) {
+	if opts.MaxMessage <= 0 {
+		opts.MaxMessage = 1 << 20
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	if opts.CheckOrigin == nil {
+		opts.CheckOrigin = sameOrigin
+	}
+
+	if !headerHasToken(r.Header, "connection", "upgrade") || !headerHasToken(r.Header, "upgrade", "websocket") {
+		return nil, &HandshakeError{Message: "expected Connection: upgrade and Upgrade: websocket"}
+	}
+	if r.Header.Get("sec-websocket-version") != "13" {
+		return nil, &HandshakeError{Message: "unsupported Sec-WebSocket-Version; 13 is required"}
+	}
+	key := r.Header.Get("sec-websocket-key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return nil, &HandshakeError{Message: "invalid Sec-WebSocket-Key"}
+	}
+	if !opts.CheckOrigin(r) {
+		return nil, ErrOrigin
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's read and write deadlines were meant for one request.
+	_ = conn.SetDeadline(time.Time{})
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	for name, values := range w.Header() {
+		for _, v := range values {
+			b.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+	_ = conn.SetWriteDeadline(time.Now().Add(opts.WriteTimeout))
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &Conn{conn: conn, br: brw.Reader, opts: opts}, nil
+}
+
+// sameOrigin allows clients that send no Origin, which browsers always do,
+// and pages served from the host they connect to.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs skipped on the way. A close frame from the peer is echoed and
+// reported as *CloseError.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		op  int
+		msg []byte
+	)
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch frameOp {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code, reason := CloseNormal, ""
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+				reason = string(payload[2:])
+			}
+			_ = c.Close(code, "")
+			return 0, nil, &CloseError{Code: code, Reason: reason}
+		case OpText, OpBinary:
+			if op != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "new message inside a fragmented one")
+			}
+			op = frameOp
+		case opContinuation:
+			if op == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "continuation without a message")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(msg)+len(payload)) > c.opts.MaxMessage {
+			return 0, nil, c.fail(CloseTooLarge, "message too large")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return op, msg, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	op := int(head[0] & 0x0F)
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "client frames must be masked")
+	}
+
+	n := int64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint64(ext[:]) & (1<<63 - 1))
+	}
+	if op >= opClose && (n > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if n > c.opts.MaxMessage {
+		return false, 0, nil, c.fail(CloseTooLarge, "message too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteText sends one unfragmented text message.
+func (c *Conn) WriteText(p []byte) error {
+	return c.writeFrame(OpText, p)
+}
+
+// WriteJSON encodes v and sends it as a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteText(b)
+}
+
+// Ping sends a ping control frame; browsers and most clients answer it
+// without application code.
+func (c *Conn) Ping() error {
+	return c.writeFrame(opPing, nil)
+}
+
+// Close sends a close frame with code and reason and closes the connection.
+// Calling it again is a no-op.
+func (c *Conn) Close(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	_ = c.writeFrame(opClose, payload)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// fail closes the connection for a protocol violation.
+func (c *Conn) fail(code int, reason string) error {
+	_ = c.Close(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+func (c *Conn) writeFrame(op int, p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	head := make([]byte, 2, 10)
+	head[0] = 0x80 | byte(op)
+	switch {
+	case len(p) < 126:
+		head[1] = byte(len(p))
+	case len(p) <= 0xFFFF:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(len(p)))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(len(p)))
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	if _, err := c.conn.Write(append(head, p...)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type frame struct {
+	fin     bool
+	op      int
+	payload string
+}
+
+// encode builds a client frame; unmasked frames are a protocol error.
+func (f frame) encode(masked bool) []byte {
+	b := []byte{byte(f.op)}
+	if f.fin {
+		b[0] |= 0x80
+	}
+	var maskBit byte
+	if masked {
+		maskBit = 0x80
+	}
+	switch n := len(f.payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xFFFF:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !masked {
+		return append(b, f.payload...)
+	}
+	mask := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	b = append(b, mask[:]...)
+	for i := 0; i < len(f.payload); i++ {
+		b = append(b, f.payload[i]^mask[i%4])
+	}
+	return b
+}
+
+func text(s string) frame { return frame{fin: true, op: OpText, payload: s} }
+
+func closeFrame(code int, reason string) frame {
+	p := binary.BigEndian.AppendUint16(nil, uint16(code))
+	return frame{fin: true, op: opClose, payload: string(p) + reason}
+}
+
+// readServerFrame reads one unmasked frame sent by the server.
+func readServerFrame(t *testing.T, br *bufio.Reader) frame {
+	t.Helper()
+	var head [2]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil {
+		t.Fatalf("reading frame: %v", err)
+	}
+	if head[1]&0x80 != 0 {
+		t.Fatal("server frame is masked")
+	}
+	n := int(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		_, _ = io.ReadFull(br, ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, _ = io.ReadFull(br, ext[:])
+		n = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(br, p); err != nil {
+		t.Fatalf("reading payload: %v", err)
+	}
+	return frame{fin: head[0]&0x80 != 0, op: int(head[0] & 0x0F), payload: string(p)}
+}
+
+// echoServer upgrades every request and echoes messages until ReadMessage
+// fails; the error is sent on errs.
+func echoServer(t *testing.T, opts Options, errs chan<- error) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, opts)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, ErrOrigin) {
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		for {
+			op, msg, err := c.ReadMessage()
+			if err != nil {
+				errs <- err
+				return
+			}
+			if err := c.writeFrame(op, msg); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// dial performs the handshake with extra headers and returns the response
+// and the connection.
+func dial(t *testing.T, srv *httptest.Server, header http.Header) (*http.Response, net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	req.Header.Set("connection", "keep-alive, Upgrade")
+	req.Header.Set("upgrade", "websocket")
+	req.Header.Set("sec-websocket-version", "13")
+	req.Header.Set("sec-websocket-key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, conn, br
+}
+
+func TestFrames(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name      string
+		max       int64
+		send      []frame
+		unmasked  bool
+		want      []frame
+		wantClose int // close code the server ends with; 0 when it stays open
+	}{
+		{
+			name: "masked text",
+			send: []frame{text("hello")},
+			want: []frame{text("hello")},
+		},
+		{
+			name: "binary",
+			send: []frame{{fin: true, op: OpBinary, payload: "\x00\x01"}},
+			want: []frame{{fin: true, op: OpBinary, payload: "\x00\x01"}},
+		},
+		{
+			name: "16-bit length",
+			send: []frame{text(long)},
+			want: []frame{text(long)},
+		},
+		{
+			name:      "unmasked",
+			send:      []frame{text("hello")},
+			unmasked:  true,
+			want:      []frame{closeFrame(CloseProtocolError, "client frames must be masked")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name: "fragments with interleaved ping",
+			send: []frame{
+				{op: OpText, payload: "Hel"},
+				{fin: true, op: opPing, payload: "p"},
+				{op: opContinuation, payload: "lo "},
+				{fin: true, op: opPong},
+				{fin: true, op: opContinuation, payload: "world"},
+			},
+			want: []frame{{fin: true, op: opPong, payload: "p"}, text("Hello world")},
+		},
+		{
+			name:      "continuation without a message",
+			send:      []frame{{fin: true, op: opContinuation, payload: "x"}},
+			want:      []frame{closeFrame(CloseProtocolError, "continuation without a message")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "new message inside a fragmented one",
+			send:      []frame{{op: OpText, payload: "a"}, text("b")},
+			want:      []frame{closeFrame(CloseProtocolError, "new message inside a fragmented one")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "fragmented ping",
+			send:      []frame{{op: opPing, payload: "p"}},
+			want:      []frame{closeFrame(CloseProtocolError, "invalid control frame")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "reserved bits",
+			send:      []frame{{fin: true, op: OpText | 0x40, payload: "x"}},
+			want:      []frame{closeFrame(CloseProtocolError, "reserved bits set")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "unknown opcode",
+			send:      []frame{{fin: true, op: 0x3}},
+			want:      []frame{closeFrame(CloseProtocolError, "unknown opcode")},
+			wantClose: CloseProtocolError,
+		},
+		{
+			name:      "oversized frame",
+			max:       8,
+			send:      []frame{text("123456789")},
+			want:      []frame{closeFrame(CloseTooLarge, "message too large")},
+			wantClose: CloseTooLarge,
+		},
+		{
+			name:      "oversized message",
+			max:       8,
+			send:      []frame{{op: OpText, payload: "12345"}, {fin: true, op: opContinuation, payload: "6789"}},
+			want:      []frame{closeFrame(CloseTooLarge, "message too large")},
+			wantClose: CloseTooLarge,
+		},
+		{
+			name:      "close is echoed",
+			send:      []frame{closeFrame(CloseGoingAway, "bye")},
+			want:      []frame{closeFrame(CloseGoingAway, "")},
+			wantClose: CloseGoingAway,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			srv := echoServer(t, Options{MaxMessage: tt.max}, errs)
+			res, conn, br := dial(t, srv, nil)
+			if res.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("handshake status %d", res.StatusCode)
+			}
+
+			for _, f := range tt.send {
+				if _, err := conn.Write(f.encode(!tt.unmasked)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, want := range tt.want {
+				if got := readServerFrame(t, br); got != want {
+					t.Errorf("got frame %+v, want %+v", got, want)
+				}
+			}
+			if tt.wantClose == 0 {
+				return
+			}
+
+			var ce *CloseError
+			if err := <-errs; !errors.As(err, &ce) || ce.Code != tt.wantClose {
+				t.Errorf("server ended with %v, want close code %d", err, tt.wantClose)
+			}
+			if _, err := br.ReadByte(); err != io.EOF {
+				t.Errorf("connection still open after close: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	sameHost := func(srv *httptest.Server) string { return srv.URL }
+	tests := []struct {
+		name        string
+		header      http.Header
+		origin      func(*httptest.Server) string
+		checkOrigin func(*http.Request) bool
+		wantStatus  int
+	}{
+		{name: "valid", wantStatus: http.StatusSwitchingProtocols},
+		{name: "same-host origin", origin: sameHost, wantStatus: http.StatusSwitchingProtocols},
+		{name: "foreign origin", origin: func(*httptest.Server) string { return "https://evil.example" }, wantStatus: http.StatusForbidden},
+		{
+			name:        "custom origin check",
+			origin:      func(*httptest.Server) string { return "https://app.example" },
+			checkOrigin: func(r *http.Request) bool { return r.Header.Get("origin") == "https://app.example" },
+			wantStatus:  http.StatusSwitchingProtocols,
+		},
+		{name: "no upgrade", header: http.Header{"Upgrade": {"h2c"}}, wantStatus: http.StatusBadRequest},
+		{name: "old version", header: http.Header{"Sec-Websocket-Version": {"8"}}, wantStatus: http.StatusBadRequest},
+		{name: "short key", header: http.Header{"Sec-Websocket-Key": {"c2hvcnQ="}}, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := echoServer(t, Options{CheckOrigin: tt.checkOrigin}, make(chan error, 1))
+			header := tt.header.Clone()
+			if tt.origin != nil {
+				if header == nil {
+					header = http.Header{}
+				}
+				header.Set("origin", tt.origin(srv))
+			}
+			res, _, _ := dial(t, srv, header)
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusSwitchingProtocols {
+				if got := res.Header.Get("sec-websocket-accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+					t.Errorf("Sec-WebSocket-Accept = %q", got)
+				}
+			}
+		})
+	}
+}